@@ -89,7 +89,7 @@ build_go() {
     fi
     
     # Build with optimization flags
-    go build -ldflags="-s -w" -o "../dist/$output_name" main.go
+    go build -ldflags="-s -w" -o "../dist/$output_name" .
     
     cd ..
     
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"ssh-keygen/vanity"
+)
+
+// runBenchmark measures how fast opts generate keys for duration, without
+// searching for anything, and returns the exit status. The rate goes to
+// report, so it can be captured like a result.
+func runBenchmark(opts vanity.Options, keyName string, duration time.Duration, summaryJSON bool, info, report io.Writer) int {
+	fmt.Fprintf(info, "Benchmarking %s key generation for %s\n", keyName, duration)
+	fmt.Fprintf(info, "Using %d cores, %d workers\n", runtime.NumCPU(), opts.Workers)
+
+	// Ctrl-C or SIGTERM cuts the run short but still reports the rate
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if opts.Attempts == nil {
+		opts.Attempts = new(uint64)
+	}
+	startTime := time.Now()
+	rate, err := vanity.Benchmark(ctx, opts, duration)
+	elapsed := time.Since(startTime)
+	status := 0
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(info, "Benchmark interrupted\n")
+		status = exitInterrupted
+	}
+
+	total := atomic.LoadUint64(opts.Attempts)
+	fmt.Fprintf(report, "Generated %d keys in %.1fs\n", total, elapsed.Seconds())
+	fmt.Fprintf(report, "Rate: %.0f keys/sec (%.0f per worker)\n", rate, rate/float64(opts.Workers))
+
+	if summaryJSON {
+		summary := jsonSummary{TotalAttempts: total, Workers: opts.Workers}
+		if err := writeSummaryJSON(os.Stderr, summary, elapsed); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON summary: %v\n", err)
+			return 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ssh-keygen/vanity"
+)
+
+// confirmCalibrationTime is how long a search measures the key rate before
+// asking whether it is worth running
+const confirmCalibrationTime = time.Second
+
+// slowestRate is a key rate in keys a second below which no machine is
+// expected to search, RSA included, so a search that needs fewer attempts
+// than this rate manages within the threshold starts without measuring
+const slowestRate = 100
+
+// errDeclined is returned when the search is turned down at the prompt
+var errDeclined = errors.New("search cancelled")
+
+// confirmExpensive measures the key rate when the search opts describe may
+// take longer than threshold and, if it does, prints the expected time with
+// cheaper alternatives and asks on stdin whether to go ahead. Without a
+// terminal to ask at it refuses, since nobody would see the question.
+func confirmExpensive(opts vanity.Options, threshold time.Duration) error {
+	expected, ok := opts.ExpectedAttempts()
+	if !ok || expected <= threshold.Seconds()*slowestRate {
+		return nil
+	}
+
+	rate, err := vanity.MeasureRate(context.Background(), opts, confirmCalibrationTime)
+	if err != nil {
+		return err
+	}
+	seconds := expected / rate
+	if seconds <= threshold.Seconds() {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "This search is expected to take %s at ~%.0f keys/s\n", formatSeconds(seconds), rate)
+	for _, alt := range cheaperAlternatives(opts) {
+		if altExpected, ok := alt.opts.ExpectedAttempts(); ok && altExpected < expected {
+			fmt.Fprintf(os.Stderr, "  %s would take %s\n", alt.label, formatSeconds(altExpected/rate))
+		}
+	}
+
+	if !stdinIsTerminal() {
+		return fmt.Errorf("the search is expected to take over %s; pass --yes to run it anyway", formatSeconds(threshold.Seconds()))
+	}
+	fmt.Fprint(os.Stderr, "Continue anyway? [y/N] ")
+	answer, err := stdinReader.ReadString('\n')
+	if err != nil && answer == "" {
+		return fmt.Errorf("reading answer: %v", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errDeclined
+}
+
+// alternative is a cheaper variant of a search, as suggested to the user
+type alternative struct {
+	label string
+	opts  vanity.Options
+}
+
+// cheaperAlternatives returns variants of opts that are usually much cheaper:
+// ignoring case, and literal targets one character shorter, trimmed at the
+// end that leaves an anchored target anchored
+func cheaperAlternatives(opts vanity.Options) []alternative {
+	if opts.Regex || len(opts.Targets) == 0 {
+		return nil
+	}
+
+	var alts []alternative
+	if !opts.CaseInsensitive && opts.CaseBudget == 0 {
+		ci := opts
+		ci.CaseInsensitive = true
+		ci.TargetCases = nil
+		label := "--ci"
+		// --ci replaces the guess, which cannot be combined with it
+		if ci.SmartCase {
+			ci.SmartCase = false
+			label = "--ci instead of --smart-case"
+		}
+		alts = append(alts, alternative{label: label, opts: ci})
+	}
+
+	var shorter []string
+	for _, target := range opts.Targets {
+		// Wildcards, classes and escapes would need parsing to trim safely
+		if len(target) < 2 || strings.ContainsAny(target, "?*[\\") {
+			return alts
+		}
+		if opts.Mode == vanity.ModeSuffix {
+			shorter = append(shorter, target[1:])
+		} else {
+			shorter = append(shorter, target[:len(target)-1])
+		}
+	}
+	short := opts
+	short.Targets = shorter
+	alts = append(alts, alternative{label: "Targeting " + strings.Join(shorter, ", "), opts: short})
+	return alts
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"ssh-keygen/vanity"
+)
+
+// calibrationTime is how long --estimate searches to measure the key rate
+const calibrationTime = 3 * time.Second
+
+// percentiles are the shares of searches --estimate gives a time for
+var percentiles = []float64{0.5, 0.9, 0.99}
+
+// printEstimate measures how fast this machine searches for opts and prints
+// how long a search can be expected to take, without keeping any key
+func printEstimate(opts vanity.Options) error {
+	fmt.Printf("Measuring the key rate for %s...\n", calibrationTime)
+	rate, err := vanity.MeasureRate(context.Background(), opts, calibrationTime)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rate: ~%.0f keys/s\n", rate)
+
+	expected, ok := opts.ExpectedAttempts()
+	if !ok {
+		fmt.Println("Expected attempts: unknown (no estimate for regular expressions or randomart)")
+		return nil
+	}
+	fmt.Printf("Expected attempts: ~%.0f\n", expected)
+	fmt.Printf("Expected time: %s\n", formatSeconds(expected/rate))
+
+	// Every key is an independent try, so the attempts needed follow a
+	// geometric distribution with a long tail: a search takes well over
+	// the mean one time in three
+	p, _ := opts.Probability()
+	for _, q := range percentiles {
+		attempts := math.Ceil(math.Log1p(-q) / math.Log1p(-p))
+		fmt.Printf("%2.0f%% of searches finish within: %s (%.0f attempts)\n", q*100, formatSeconds(attempts/rate), attempts)
+	}
+	return nil
+}
+
+// formatSeconds renders a duration that may run to years, which
+// time.Duration can neither hold nor print readably
+func formatSeconds(seconds float64) string {
+	const (
+		minute = 60
+		hour   = 60 * minute
+		day    = 24 * hour
+		year   = 365.25 * day
+	)
+	switch {
+	case math.IsInf(seconds, 0) || seconds > 1e6*year:
+		return "more than a million years"
+	case seconds >= year:
+		return fmt.Sprintf("%.1f years", seconds/year)
+	case seconds >= day:
+		return fmt.Sprintf("%.1f days", seconds/day)
+	case seconds >= hour:
+		return fmt.Sprintf("%.1f hours", seconds/hour)
+	case seconds >= minute:
+		return fmt.Sprintf("%.1f minutes", seconds/minute)
+	case seconds >= 1:
+		return fmt.Sprintf("%.0f seconds", seconds)
+	}
+	return "under a second"
+}
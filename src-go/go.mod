@@ -2,6 +2,9 @@ module ssh-keygen
 
 go 1.24.4
 
-require golang.org/x/crypto v0.41.0
+require (
+	golang.org/x/crypto v0.41.0
+	golang.org/x/term v0.34.0
+)
 
 require golang.org/x/sys v0.35.0 // indirect
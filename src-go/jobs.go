@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"ssh-keygen/vanity"
+)
+
+// jobSpec is one entry of a --jobs file: the key one person wants
+type jobSpec struct {
+	Pattern string `json:"pattern"` // target, or comma-separated targets
+	Case    string `json:"case"`    // sensitive, insensitive or empty for --ci
+	Comment string `json:"comment"` // empty for --comment
+	Out     string `json:"out"`     // empty for a numbered file after --out
+}
+
+// set assigns the field a YAML key names
+func (j *jobSpec) set(key, value string) error {
+	switch key {
+	case "pattern":
+		j.Pattern = value
+	case "case":
+		j.Case = value
+	case "comment":
+		j.Comment = value
+	case "out":
+		j.Out = value
+	default:
+		return fmt.Errorf("unknown field %q; jobs have pattern, case, comment and out", key)
+	}
+	return nil
+}
+
+// label names the job in progress and reports
+func (j jobSpec) label(i int) string {
+	return fmt.Sprintf("Job %d (%s)", i+1, j.Pattern)
+}
+
+// readJobs loads a --jobs file, which is either a JSON array of objects or
+// the YAML equivalent as a list of flat mappings, and checks every entry
+func readJobs(path string) ([]jobSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []jobSpec
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&jobs); err != nil {
+			return nil, err
+		}
+	} else if jobs, err = parseJobsYAML(string(data)); err != nil {
+		return nil, err
+	}
+
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no jobs listed")
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Pattern == "" {
+			return nil, fmt.Errorf("job %d has no pattern", i+1)
+		}
+		if strings.ContainsAny(job.Comment, "\r\n") {
+			return nil, fmt.Errorf("%s: the comment cannot contain line breaks", job.label(i))
+		}
+		if _, err := parseJobCase(job.Case); err != nil {
+			return nil, fmt.Errorf("%s: %v", job.label(i), err)
+		}
+	}
+	return jobs, nil
+}
+
+// parseJobsYAML reads the subset of YAML a jobs file needs: a list, perhaps
+// under a jobs key, of mappings from field names to plain or quoted strings,
+// with # comments. Continuation lines are not checked for indentation; each
+// field belongs to the entry the last dash started.
+func parseJobsYAML(text string) ([]jobSpec, error) {
+	var jobs []jobSpec
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(stripYAMLComment(line))
+		if line == "" || line == "---" || line == "jobs:" {
+			continue
+		}
+
+		// A dash starts the next entry, and may carry its first field
+		if rest, ok := strings.CutPrefix(line, "-"); ok && (rest == "" || rest[0] == ' ') {
+			jobs = append(jobs, jobSpec{})
+			if line = strings.TrimSpace(rest); line == "" {
+				continue
+			}
+		} else if len(jobs) == 0 {
+			return nil, fmt.Errorf("line %d: expected a list entry starting with -", n+1)
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected field: value", n+1)
+		}
+		value, err := yamlScalar(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if err := jobs[len(jobs)-1].set(strings.TrimSpace(key), value); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+	}
+	return jobs, nil
+}
+
+// stripYAMLComment drops a # comment from line, which starts the line or
+// follows a space outside quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlScalar unquotes a YAML string, which may be plain, 'single-quoted' with
+// ” for a quote, or "double-quoted" with backslash escapes
+func yamlScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted string %s", value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated single-quoted string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return value, nil
+}
+
+// parseJobCase parses the case of a job, spelled out or as the ci: and cs:
+// prefixes of --target spell it
+func parseJobCase(text string) (vanity.Case, error) {
+	switch strings.ToLower(text) {
+	case "":
+		return vanity.CaseDefault, nil
+	case "insensitive", "ci":
+		return vanity.CaseInsensitive, nil
+	case "sensitive", "cs":
+		return vanity.CaseSensitive, nil
+	}
+	return 0, fmt.Errorf("case must be sensitive or insensitive, got %q", text)
+}
+
+// resolveJobPaths turns the out path of every job into the path of its key
+// files, numbering the keys after keyFile for jobs that leave it out
+func resolveJobPaths(jobs []jobSpec, keyFile string) error {
+	seen := make(map[string]int)
+	for i := range jobs {
+		path := numberedKeyFile(keyFile, i+1)
+		if jobs[i].Out != "" {
+			var err error
+			if path, err = expandHome(jobs[i].Out); err != nil {
+				return err
+			}
+		}
+		if other, ok := seen[path]; ok {
+			return fmt.Errorf("job %d and job %d would both write %s", other+1, i+1, path)
+		}
+		seen[path] = i
+		jobs[i].Out = path
+	}
+	return nil
+}
+
+// jobRun holds what a --jobs search needs from the command line
+type jobRun struct {
+	opts    vanity.Options // everything the jobs share
+	keyName string         // such as "ed25519" or "4096-bit RSA"
+	jobs    []jobSpec      // with resolved out paths
+	comment string         // for jobs without one of their own
+
+	format, privateSuffix, passphrase string
+	modes                             keyModes
+	authorizedPath                    string
+	jsonOut, summaryJSON              bool
+
+	timeout     time.Duration
+	maxAttempts uint64
+	quiet       bool
+	estimate    bool      // stop after the banner
+	info        io.Writer // the banner and statistics
+	report      io.Writer // what each key turned out to be
+}
+
+// runJobs searches for a key for every job at once, writing each as soon as
+// it turns up, and returns the exit status
+func runJobs(run jobRun) int {
+	opts := run.opts
+	jobs := make([]vanity.Job, len(run.jobs))
+	for i, spec := range run.jobs {
+		jobs[i].Case, _ = parseJobCase(spec.Case)
+		jobs[i].Targets = []string{spec.Pattern}
+		if !opts.Regex {
+			jobs[i].Targets = strings.Split(spec.Pattern, ",")
+		}
+		if err := jobs[i].Options(opts).Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", spec.label(i), err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(run.info, "Searching for %d keys, one per job, from a single stream of %s keys\n", len(jobs), run.keyName)
+	for i, spec := range run.jobs {
+		expected := ""
+		if attempts, ok := jobs[i].Options(opts).ExpectedAttempts(); ok {
+			expected = fmt.Sprintf(", expected attempts ~%.0f", attempts)
+		}
+		caseText := "case-sensitive"
+		if jobs[i].Options(opts).CaseInsensitive {
+			caseText = "case-insensitive"
+		}
+		fmt.Fprintf(run.info, "  Job %d: %s (%s) for %s%s\n", i+1, spec.Pattern, caseText, spec.Out, expected)
+	}
+	fmt.Fprintf(run.info, "Using %d workers\n", opts.Workers)
+	if run.estimate {
+		return 0
+	}
+
+	// Ctrl-C or SIGTERM cancels the search; finished jobs are already on
+	// disk by then
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if run.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, run.timeout)
+		defer cancel()
+	}
+
+	if opts.Attempts == nil {
+		opts.Attempts = new(uint64)
+	}
+	done := make([]atomic.Bool, len(jobs))
+	startTime := time.Now()
+
+	// The progress line lists the jobs still waiting, so it only needs the
+	// done flags
+	if !run.quiet {
+		lastAttempts := uint64(0)
+		lastTick := time.Now()
+		opts.OnProgress = func(current uint64, elapsed time.Duration) {
+			now := time.Now()
+			rate := float64(current-lastAttempts) / now.Sub(lastTick).Seconds()
+			fmt.Fprintf(os.Stderr, "\rAttempts: %d | Rate: %.0f/s | Elapsed: %s | Jobs done: %d/%d | Waiting for: %s  ",
+				current, rate, elapsed.Truncate(time.Second), len(jobs)-len(pendingJobs(done)), len(jobs), waitingList(run.jobs, pendingJobs(done)))
+			lastAttempts, lastTick = current, now
+		}
+	}
+
+	err := vanity.SearchJobs(ctx, opts, jobs, func(result *vanity.Result) {
+		done[result.Job].Store(true)
+		run.write(result, time.Since(startTime))
+	})
+
+	var reason string
+	var status int
+	switch {
+	case err == nil:
+		fmt.Fprintf(run.info, "\nAll %d jobs done!\n", len(jobs))
+	case errors.Is(err, vanity.ErrMaxAttempts):
+		reason, status = fmt.Sprintf("Reached the limit of %d attempts", run.maxAttempts), exitMaxAttempts
+	case errors.Is(err, context.DeadlineExceeded):
+		reason, status = fmt.Sprintf("Timed out after %s", run.timeout), exitTimeout
+	case errors.Is(err, context.Canceled):
+		reason, status = "Search interrupted", exitInterrupted
+	default:
+		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		return 1
+	}
+
+	// Still said under --quiet, since the pending jobs need running again
+	if reason != "" {
+		gap := "\n\n"
+		if run.quiet {
+			gap = ""
+		}
+		pending := pendingJobs(done)
+		fmt.Fprintf(os.Stderr, "%s%s with %d of %d jobs done; still pending:\n", gap, reason, len(jobs)-len(pending), len(jobs))
+		for _, i := range pending {
+			fmt.Fprintf(os.Stderr, "  %s for %s\n", run.jobs[i].label(i), run.jobs[i].Out)
+		}
+	}
+
+	elapsed := time.Since(startTime)
+	finalAttempts := atomic.LoadUint64(opts.Attempts)
+	fmt.Fprintf(run.info, "Total attempts across all workers: %d\n", finalAttempts)
+	fmt.Fprintf(run.info, "Average rate: %.0f/s | Elapsed: %s\n", float64(finalAttempts)/elapsed.Seconds(), elapsed.Truncate(time.Second))
+
+	// The summary covers the jobs as one search, matched once all are done
+	if run.summaryJSON {
+		var patterns []string
+		for _, spec := range run.jobs {
+			patterns = append(patterns, spec.Pattern)
+		}
+		summary := jsonSummary{
+			TotalAttempts:   finalAttempts,
+			Workers:         opts.Workers,
+			Target:          strings.Join(patterns, ","),
+			Matched:         err == nil,
+			CaseInsensitive: opts.CaseInsensitive,
+		}
+		if err := writeSummaryJSON(os.Stderr, summary, elapsed); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON summary: %v\n", err)
+			return 1
+		}
+	}
+	return status
+}
+
+// write saves the key found for a job and reports it, exiting on failure
+// since the finished jobs are safe on disk
+func (run jobRun) write(result *vanity.Result, elapsed time.Duration) {
+	spec := run.jobs[result.Job]
+	comment := spec.Comment
+	if comment == "" {
+		comment = run.comment
+	}
+
+	privateKey, err := marshalPrivateKey(result.PrivateKey, run.format, comment, run.passphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError marshaling private key for %s: %v\n", spec.label(result.Job), err)
+		os.Exit(1)
+	}
+	pubKeyLine := publicKeyLine(result, comment)
+	privatePath, publicPath := spec.Out+run.privateSuffix, spec.Out+".pub"
+	if err := writeKeyFiles(privatePath, publicPath, privateKey, pubKeyLine, run.modes); err != nil {
+		fmt.Fprintf(os.Stderr, "\nError %v\n", err)
+		os.Exit(1)
+	}
+
+	// The progress line is cut short by a line of its own
+	fmt.Fprintf(run.info, "\n")
+	fmt.Fprintf(run.report, "%s found after %d attempts\n", spec.label(result.Job), result.Attempts)
+	fmt.Fprintf(run.report, "Keys written to %s and %s\n", privatePath, publicPath)
+	if run.authorizedPath != "" {
+		if err := appendLine(run.authorizedPath, pubKeyLine); err != nil {
+			fmt.Fprintf(os.Stderr, "Error appending to %s: %v\n", run.authorizedPath, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(run.report, "Public key appended to %s\n", run.authorizedPath)
+	}
+	fmt.Fprintf(run.report, "Public key: %s\n", pubKeyLine)
+	fmt.Fprintf(run.report, "Fingerprint: %s\n", result.Fingerprint)
+	for _, match := range result.Matches {
+		matchText := searchedText(result, match.Field)[match.Start:match.End]
+		fmt.Fprintf(run.report, "Matched target: %s (%q at offset %d)\n", match.Target, matchText, matchOffset(result, match))
+	}
+
+	if run.jsonOut {
+		if err := writeJSON(os.Stdout, result, pubKeyLine, nil, privatePath, publicPath, elapsed, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// pendingJobs returns the indexes of the jobs not yet done
+func pendingJobs(done []atomic.Bool) []int {
+	var pending []int
+	for i := range done {
+		if !done[i].Load() {
+			pending = append(pending, i)
+		}
+	}
+	return pending
+}
+
+// waitingList names the pending jobs for the progress line, a few at most
+func waitingList(jobs []jobSpec, pending []int) string {
+	const shown = 4
+	var names []string
+	for _, i := range pending[:min(len(pending), shown)] {
+		names = append(names, jobs[i].Pattern)
+	}
+	if len(pending) > shown {
+		names = append(names, fmt.Sprintf("%d more", len(pending)-shown))
+	}
+	if len(names) == 0 {
+		return "nothing"
+	}
+	return strings.Join(names, ", ")
+}
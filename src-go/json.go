@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"ssh-keygen/vanity"
+)
+
+// jsonResult is the object --json prints on success. Field names are part of
+// the command line interface, so existing ones must never change.
+type jsonResult struct {
+	PublicKey      string      `json:"public_key"`
+	PrivateKey     string      `json:"private_key,omitempty"`      // PEM, or PuTTY's format with --format ppk, with --stdout
+	PrivateKeyPath string      `json:"private_key_path,omitempty"` // without --stdout
+	PublicKeyPath  string      `json:"public_key_path,omitempty"`  // without --stdout
+	Fingerprint    string      `json:"fingerprint"`
+	Attempts       uint64      `json:"attempts"`
+	TotalAttempts  uint64      `json:"total_attempts"`
+	ElapsedSeconds float64     `json:"elapsed_seconds"`
+	Partial        bool        `json:"partial"` // the closest key of a --best search
+	Matches        []jsonMatch `json:"matches"`
+	Score          int         `json:"score,omitempty"` // with --min-score
+	Luck           *jsonLuck   `json:"luck,omitempty"`  // when the odds of the target can be estimated
+}
+
+// jsonMatch describes one matched target
+type jsonMatch struct {
+	Target string `json:"target"`
+	Field  string `json:"field"`            // key, fingerprint, md5, bubblebabble or hex
+	Text   string `json:"text"`             // the matched characters
+	Offset int    `json:"offset"`           // into the searched field, counted as offsetBase counts it
+	Anchor string `json:"anchor,omitempty"` // start or end, for anchored targets
+
+	// Whether the target ignored case, following --ci or its --target prefix
+	IgnoreCase bool `json:"case_insensitive"`
+
+	// Offsets into the target of mismatched characters, with --max-mismatch
+	Mismatches []int `json:"mismatches,omitempty"`
+
+	// Offsets into the target of characters found in another case, with
+	// --ci-budget
+	CaseDeviations []int `json:"case_deviations,omitempty"`
+}
+
+// writeJSON prints result as a single line of JSON. The private key is
+// either embedded as privateKey or referred to by privatePath, along with the
+// public key file at publicPath. Luck is left out when nil.
+func writeJSON(w io.Writer, result *vanity.Result, pubKeyLine string, privateKey []byte, privatePath, publicPath string, elapsed time.Duration, luck *jsonLuck) error {
+	out := jsonResult{
+		PublicKey:      pubKeyLine,
+		Fingerprint:    result.Fingerprint,
+		Attempts:       result.Attempts,
+		TotalAttempts:  result.TotalAttempts,
+		ElapsedSeconds: elapsed.Seconds(),
+		Partial:        result.Partial,
+		Score:          result.Score,
+		Matches:        []jsonMatch{},
+		Luck:           luck,
+	}
+	if privateKey != nil {
+		out.PrivateKey = string(privateKey)
+	} else {
+		out.PrivateKeyPath = privatePath
+		out.PublicKeyPath = publicPath
+	}
+
+	for _, match := range result.Matches {
+		out.Matches = append(out.Matches, jsonMatch{
+			Target:         match.Target,
+			Field:          jsonField(match.Field),
+			Text:           searchedText(result, match.Field)[match.Start:match.End],
+			Offset:         matchOffset(result, match),
+			Anchor:         jsonAnchor(match.Mode),
+			IgnoreCase:     match.IgnoreCase,
+			Mismatches:     match.Mismatches,
+			CaseDeviations: match.CaseDeviations,
+		})
+	}
+
+	return json.NewEncoder(w).Encode(out)
+}
+
+// jsonField names the field a match was found in
+func jsonField(field vanity.Field) string {
+	switch field {
+	case vanity.FieldFingerprint:
+		return "fingerprint"
+	case vanity.FieldMD5Fingerprint:
+		return "md5"
+	case vanity.FieldBubbleBabble:
+		return "bubblebabble"
+	case vanity.FieldHex:
+		return "hex"
+	}
+	return "key"
+}
+
+// jsonAnchor names the anchor a match was found at, if any
+func jsonAnchor(mode vanity.Mode) string {
+	switch mode {
+	case vanity.ModePrefix:
+		return "start"
+	case vanity.ModeSuffix:
+		return "end"
+	}
+	return ""
+}
+
+// jsonSummary is the line --summary-json adds to stderr once the search is
+// over, matched or not, for metrics scraping. Like jsonResult its field names
+// must never change.
+type jsonSummary struct {
+	TotalAttempts   uint64  `json:"total_attempts"`
+	ElapsedSeconds  float64 `json:"elapsed_seconds"`
+	KeysPerSecond   float64 `json:"keys_per_second"`
+	Workers         int     `json:"workers"`
+	Target          string  `json:"target"` // comma-separated, as on the command line
+	Matched         bool    `json:"matched"`
+	CaseInsensitive bool    `json:"case_insensitive"`
+}
+
+// writeSummaryJSON prints the --summary-json line for a search that ran for
+// elapsed
+func writeSummaryJSON(w io.Writer, summary jsonSummary, elapsed time.Duration) error {
+	summary.ElapsedSeconds = elapsed.Seconds()
+	if elapsed > 0 {
+		summary.KeysPerSecond = float64(summary.TotalAttempts) / elapsed.Seconds()
+	}
+	return json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"ssh-keygen/vanity"
+)
+
+// jsonLuck is how lucky a search was by the estimator's model, as --json
+// reports it. Like jsonResult its field names must never change.
+type jsonLuck struct {
+	Probability      float64 `json:"probability"`       // that a single key matches
+	ExpectedAttempts float64 `json:"expected_attempts"` // on average
+	Percentile       float64 `json:"percentile"`        // share of searches done within the attempts taken
+}
+
+// searchLuck compares the attempts a search took with the odds Probability
+// gives opts, or returns nil when there are none to compare with
+func searchLuck(opts vanity.Options, attempts uint64) *jsonLuck {
+	p, ok := opts.Probability()
+	if !ok || p <= 0 {
+		return nil
+	}
+	// The attempts follow a geometric distribution; 1 - (1-p)^n would round
+	// to zero for rare targets
+	return &jsonLuck{
+		Probability:      p,
+		ExpectedAttempts: 1 / p,
+		Percentile:       -math.Expm1(float64(attempts) * math.Log1p(-p)),
+	}
+}
+
+// printLuck prints the odds of the target and how a search that took
+// attempts fared against them
+func printLuck(w io.Writer, luck *jsonLuck, attempts uint64) {
+	fmt.Fprintf(w, "Odds: 1 in %.0f keys match (p = %.3g)\n", luck.ExpectedAttempts, luck.Probability)
+	ratio := float64(attempts) / luck.ExpectedAttempts
+	if luck.Percentile < 0.5 {
+		fmt.Fprintf(w, "Luck: %.3gx the expected attempts, luckier than %.4g%% of searches\n", ratio, (1-luck.Percentile)*100)
+	} else {
+		fmt.Fprintf(w, "Luck: %.3gx the expected attempts, unluckier than %.4g%% of searches\n", ratio, luck.Percentile*100)
+	}
+}
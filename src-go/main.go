@@ -1,264 +1,1999 @@
 package main
 
 import (
-	"crypto/ed25519"
-	"crypto/rand"
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/elliptic"
+	"crypto/x509"
 	"encoding/pem"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"golang.org/x/crypto/ssh"
+
+	"ssh-keygen/vanity"
 )
 
-type Result struct {
-	privateKey ed25519.PrivateKey
-	publicKey  ed25519.PublicKey
-	sshPubKey  string
-	attempts   uint64
-}
+// unreachableAttempts is roughly a day of searching at a million keys a
+// second, beyond what a desktop can be expected to manage
+const unreachableAttempts = 1e11
+
+// verboseTicks is how many progress updates pass between the worker counts
+// --verbose prints
+const verboseTicks = 10
+
+// maxRangeNumbers caps how many targets the --number-range flags may expand
+// into together, keeping the matcher's table to a few megabytes
+const maxRangeNumbers = 100000
+
+// stdoutSeparator is the line --stdout prints between the private key and
+// the public key line, for scripts to split on. Neither PEM nor PuTTY key
+// files ever hold it.
+const stdoutSeparator = "-- public key --"
+
+// Exit statuses for searches that end without a match
+const (
+	exitMaxAttempts = 3   // --max-attempts used up
+	exitTimeout     = 124 // --timeout expired, as with timeout(1)
+	exitInterrupted = 130 // stopped by SIGINT or SIGTERM, as 128 + SIGINT
+)
 
 func main() {
 	// Ensure Go uses all available CPU cores
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	if len(os.Args) < 2 || len(os.Args) > 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [--ci] <target_sequence>\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  --ci: Enable case-insensitive search\n")
+	var keyTypeName string
+	var bits int
+	var curveName string
+	var caseInsensitive bool
+	var smartCase bool
+	var confusables bool
+	var prefix bool
+	var suffix bool
+	var bodyOnly bool
+	var fullLine bool
+	var useRegex bool
+	var wordlist string
+	var blocklistFile string
+	var blockProfanity bool
+	var avoid string
+	var runSpec string
+	var startRangeSpec string
+	var palindrome int
+	var pronounceable int
+	var comment string
+	var passphrase string
+	var seedSpec string
+	var requireAll bool
+	var at int
+	var anchor string
+	var last int
+	var minCount int
+	var minScore int
+	var delimitedMatch bool
+	var maxMismatch int
+	var squashSymbols bool
+	var maxGaps int
+	var caseBudget int
+	var subsequence bool
+	var fingerprint bool
+	var fingerprintMD5 bool
+	var bubbleBabble bool
+	var hexKey bool
+	var timeout time.Duration
+	var benchmark time.Duration
+	var maxAttempts uint64
+	var count int
+	var workers int
+	var batchSize uint64
+	var bestEffort bool
+	var huntWords bool
+	var excludes stringList
+	var artSpecs stringList
+	var charsetSpecs stringList
+	var targetSpecs stringList
+	var rangeSpecs stringList
+	var fingerprintSpecs stringList
+	var fingerprintRegex string
+	var scoreSpecs stringList
+	var toStdout bool
+	var keyFormat string
+	var jsonOut bool
+	var summaryJSON bool
+	var outPath string
+	var authorizedPath string
+	var jobsFile string
+	var force bool
+	var keyModeText, pubModeText string
+	var estimate bool
+	var suggest bool
+	var dryRun bool
+	var yes bool
+	var confirmOver time.Duration
+	var quiet bool
+	var verbose bool
+	var positions bool
+
+	flag.StringVar(&keyTypeName, "type", "ed25519", "Generate `ed25519`, rsa or ecdsa keys")
+	flag.IntVar(&bits, "bits", 0, fmt.Sprintf("RSA modulus size in `bits` (default %d)", vanity.DefaultRSABits))
+	flag.StringVar(&curveName, "curve", "", "ECDSA `curve`: p256 (default), p384 or p521")
+	flag.BoolVar(&caseInsensitive, "ci", false, "Enable case-insensitive search")
+	flag.BoolVar(&smartCase, "smart-case", false, "Ignore case for targets written without uppercase letters and match the others exactly, like vim's smartcase")
+	flag.BoolVar(&confusables, "confusables", false, "Let look-alike characters match each other (0/O/o, 1/l/I, 2/Z, 5/S, 8/B)")
+	flag.BoolVar(&confusables, "confusable", false, "Same as --confusables")
+	flag.BoolVar(&prefix, "prefix", false, "Require the target right after the fixed base64 key header")
+	flag.BoolVar(&suffix, "suffix", false, "Require the target at the end of the base64 key body, right before any = padding")
+	flag.BoolVar(&suffix, "ends-with", false, "Same as --suffix")
+	flag.StringVar(&anchor, "anchor", "", "Where the target may appear: `start` as --prefix, end as --suffix, either of the two, or any (default)")
+	flag.IntVar(&at, "at", -1, "Require the target to start exactly `N` characters after the fixed base64 key header")
+	flag.IntVar(&last, "last", 0, "Only accept a match lying within the final `N` characters of the key body, which stay visible when it is truncated")
+	flag.StringVar(&startRangeSpec, "range", "", "Only accept a match starting at an offset from `start:end`, end excluded, counted like --at after the fixed header")
+	flag.IntVar(&minCount, "min-count", 1, "Require the target to occur at least `N` times, overlaps included")
+	flag.BoolVar(&delimitedMatch, "delimited", false, "Only accept the target where the characters around it differ in case from its ends, or are digits, so it stands out as in 9Dave7")
+	flag.IntVar(&minScore, "min-score", 0, "Accept a key once the weights of the targets it holds add up to `N`, instead of any one target")
+	flag.IntVar(&maxMismatch, "max-mismatch", 0, "Also accept the target with up to `K` characters differing")
+	flag.BoolVar(&squashSymbols, "squash-symbols", false, "Match the target as if the '+' and '/' of the base64 were removed, so one may split it")
+	flag.IntVar(&maxGaps, "max-gaps", 1, "With --squash-symbols, allow up to `N` '+' or '/' within the match")
+	flag.BoolVar(&subsequence, "subsequence", false, "Match the target's characters in order anywhere in the key, with anything between them, and print the offset of each in the base64 key body")
+	flag.IntVar(&caseBudget, "ci-budget", 0, "Ignore case, but only accept the target with at most `K` letters in another case than typed")
+	flag.BoolVar(&fingerprint, "fingerprint", false, "Match against the SHA256 fingerprint instead of the public key; it holds 43 base64 characters (A-Z, a-z, 0-9, + and /), the last one of AEIMQUYcgkosw048")
+	flag.BoolVar(&fingerprint, "match-fingerprint", false, "Same as --fingerprint")
+	flag.BoolVar(&fingerprintMD5, "fingerprint-md5", false, "Match against the legacy MD5 fingerprint hex (colons optional) instead of the public key")
+	flag.BoolVar(&fingerprintMD5, "match-md5-fingerprint", false, "Same as --fingerprint-md5")
+	flag.BoolVar(&hexKey, "hex", false, "Match against the raw 32-byte ed25519 public key as 64 lowercase hex digits instead of its base64 form")
+	flag.BoolVar(&bubbleBabble, "bubblebabble", false, "Match against the Bubble Babble digest shown by ssh-keygen -B instead of the public key")
+	flag.BoolVar(&requireAll, "all", false, "Require every target to appear instead of any one of them")
+	flag.BoolVar(&bodyOnly, "body-only", false, "Search the whole base64 key body, including the fixed header")
+	flag.BoolVar(&fullLine, "match-full-line", false, "Search the whole authorized_keys line, including the key type")
+	flag.BoolVar(&useRegex, "regex", false, "Treat the target as a regular expression")
+	flag.DurationVar(&timeout, "timeout", 0, "Give up if no match is found within `duration` (e.g. 30m)")
+	flag.Uint64Var(&maxAttempts, "max-attempts", 0, "Give up after generating `N` keys without a match")
+	flag.StringVar(&jobsFile, "jobs", "", "Find a key for every entry of a YAML or JSON `file` giving a pattern, case, comment and out path, all from one shared search")
+	flag.IntVar(&count, "count", 1, "Keep searching until `N` distinct keys match, written to numbered files such as id_ed25519_1")
+	flag.IntVar(&workers, "workers", 0, "Generate keys with `N` goroutines (default 3 per CPU core)")
+	flag.Uint64Var(&batchSize, "batch", 0, "Keys each worker generates between progress counter updates; larger `N` means less contention but laggier progress (default 1000, or 1 for RSA)")
+	flag.BoolVar(&bestEffort, "best", false, "When --timeout, --max-attempts or Ctrl-C stops the search, keep the key holding the longest start of the target instead of nothing")
+	flag.BoolVar(&huntWords, "hunt-words", false, "Search for no target but keep the key holding the longest dictionary word until --timeout, --max-attempts or Ctrl-C stops the search; --wordlist replaces the built-in dictionary")
+	flag.Var(&excludes, "exclude", "Reject keys containing `seq` anywhere, even when they match; may be repeated")
+	flag.Var(&artSpecs, "randomart", "Require the randomart of ssh-keygen -lv to show `row:col:char`, counted from 0:0 at the top left; may be repeated")
+	flag.Var(&targetSpecs, "target", "Also look for `seq`, which may start with ci: or cs: to match it ignoring or respecting case whatever --ci says; may be repeated")
+	flag.Var(&rangeSpecs, "number-range", "Also look for any decimal number from `low:high`, such as 1990:1999; a low bound written with leading zeros pads every number to its width; may be repeated")
+	flag.Var(&scoreSpecs, "score", "Also look for a target weighted towards --min-score, as `seq=weight`; other targets weigh 1; may be repeated")
+	flag.StringVar(&fingerprintRegex, "fp-regex", "", "Also require the whole SHA256 fingerprint, SHA256: prefix included, to match the regular expression `re`, such as ^SHA256:[A-Za-z0-9+/]*cafe")
+	flag.Var(&fingerprintSpecs, "fp-target", "Also require the SHA256 fingerprint of the key to contain `seq`, checked only once the key itself matches; may be repeated")
+	flag.Var(&charsetSpecs, "charset-region", "Require the characters at `start:len:class` after the fixed header to be digits, lower, upper or alpha; a negative start counts from the end of the key; may be repeated")
+	flag.StringVar(&runSpec, "run", "", "Look for a run of one character repeated, as `char:count`, or any:count for any character, instead of a target")
+	flag.StringVar(&outPath, "out", "", "Write the private key to `path` and the public key to path.pub (default id_<type> in the current directory)")
+	flag.StringVar(&keyFormat, "format", "openssh", "Private key `format`: openssh, pkcs8 for an unencrypted PKCS #8 PEM file, or ppk for a PuTTY version 3 file written with a .ppk extension")
+	flag.BoolVar(&toStdout, "stdout", false, "Print the private key, a line reading exactly \""+stdoutSeparator+"\" and the public key line to stdout instead of writing files, with everything else on stderr")
+	flag.BoolVar(&jsonOut, "json", false, "Print the result as a single JSON object on stdout, with everything else on stderr")
+	flag.BoolVar(&summaryJSON, "summary-json", false, "Finish with one JSON line on stderr giving the attempts, elapsed time, rate, workers, target and outcome, for metrics scraping")
+	flag.StringVar(&authorizedPath, "append-authorized", "", "Also append the public key line to `path`, such as ~/.ssh/authorized_keys, creating it if needed")
+	flag.BoolVar(&force, "force", false, "Overwrite existing key files instead of refusing to start")
+	flag.StringVar(&keyModeText, "key-mode", "0600", "Write the private key with the octal permissions `mode`, whatever the umask")
+	flag.StringVar(&pubModeText, "pub-mode", "0644", "Write the public key with the octal permissions `mode`, whatever the umask")
+	flag.BoolVar(&quiet, "quiet", false, "Print only the result: no banner, progress line or statistics")
+	flag.BoolVar(&positions, "positions", false, "Also print the offset of every occurrence of each matched target within the base64 key body or the searched digest, counted like every other offset printed")
+	flag.BoolVar(&verbose, "verbose", false, "Also list the attempts of every worker every 10 seconds, to spot starved cores")
+	flag.DurationVar(&benchmark, "benchmark", 0, "Generate keys for `duration` (e.g. 10s) without searching for anything and print the key rate, to compare hardware or tune --workers and --batch")
+	flag.BoolVar(&dryRun, "dry-run", false, "Check every option and target as a real run would, print the plan with its workers, batch size, output paths and expected attempts, and exit without generating a key")
+	flag.BoolVar(&estimate, "estimate", false, "Measure the key rate briefly and print the expected attempts and time of the search, then exit without keeping a key")
+	flag.BoolVar(&yes, "yes", false, "Start the search without asking, however long it is expected to take")
+	flag.DurationVar(&confirmOver, "confirm-over", 24*time.Hour, "Ask before starting a search expected to take longer than `duration` at the measured key rate; 0 never asks")
+	flag.IntVar(&palindrome, "palindrome", 0, "Look for a palindrome of at least `N` characters instead of a target")
+	flag.IntVar(&pronounceable, "pronounceable", 0, "Look for a key ending in `N` characters of consonant-vowel syllables, such as tabeko, instead of a target")
+	flag.StringVar(&comment, "comment", "", "Store `text` such as user@host as the key comment")
+	flag.StringVar(&seedSpec, "seed", "", "INSECURE: draw ed25519 keys from a deterministic stream seeded with `N`, so that a single worker finds the same key every run; for tests and demos only, never for real credentials")
+	flag.StringVar(&passphrase, "passphrase", "", "Encrypt the private key with `text`; pass an empty value to be prompted without echo, which keeps it out of the process list")
+	flag.StringVar(&blocklistFile, "blocklist", "", "Reject matching keys whose base64 body or fingerprint holds, in any case, a sequence listed in `file`, one per line")
+	flag.StringVar(&avoid, "avoid", "", "Reject matching keys showing any of `chars` anywhere after the fixed header, compared exactly, such as lI0O for a key that cannot be misread")
+	flag.BoolVar(&blockProfanity, "block-profanity", false, "Reject matching keys whose base64 body or fingerprint shows, in any case, a word of the built-in list of profanities and slurs")
+	flag.StringVar(&wordlist, "wordlist", "", "Also accept any target listed in `file`, one per line")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <target_sequence>[,target_sequence...] ...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s estimate <target_sequence>... [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s suggest <target_sequence> [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s --benchmark <duration> [options]\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nOffsets printed for a match, and in --json, count from the start of the base64 key body after the key type, or of the fingerprint after SHA256:; --at and --range count from the end of the fixed header instead.\n")
+	}
+
+	// The estimate subcommand is --estimate spelled as a command, and lets
+	// options follow the targets as in "estimate yegor --ci". The suggest
+	// subcommand estimates cheaper variants of the target instead, and
+	// likewise writes nothing.
+	var args []string
+	if len(os.Args) > 1 && (os.Args[1] == "estimate" || os.Args[1] == "suggest") {
+		estimate = true
+		suggest = os.Args[1] == "suggest"
+		args = parseInterspersed(flag.CommandLine, os.Args[2:])
+	} else {
+		flag.Parse()
+		args = flag.Args()
+	}
+
+	// Progress and statistics always go to stderr so scripts can capture the
+	// result from stdout, which the keys themselves or the JSON object take
+	// over with --stdout or --json
+	var report io.Writer = os.Stdout
+	if toStdout || jsonOut {
+		report = os.Stderr
+	}
+
+	// The banner and statistics around the result, which --quiet drops
+	var info io.Writer = os.Stderr
+	if quiet {
+		info = io.Discard
+	}
+
+	searching := len(args) > 0 || len(targetSpecs) > 0 || len(rangeSpecs) > 0 || len(scoreSpecs) > 0 || len(fingerprintSpecs) > 0 || fingerprintRegex != "" || wordlist != "" || runSpec != "" || palindrome != 0 || pronounceable != 0 || len(artSpecs) > 0 || len(charsetSpecs) > 0 || huntWords || jobsFile != ""
+	switch {
+	case benchmark < 0:
+		fmt.Fprintf(os.Stderr, "Error: --benchmark needs a positive duration\n")
+		os.Exit(1)
+	case benchmark > 0 && (searching || estimate):
+		fmt.Fprintf(os.Stderr, "Error: --benchmark searches for nothing and cannot take targets or --estimate\n")
+		os.Exit(1)
+	case suggest && (jobsFile != "" || runSpec != "" || palindrome != 0 || pronounceable != 0 || huntWords):
+		fmt.Fprintf(os.Stderr, "Error: suggest takes a single literal target, without --jobs, --run, --palindrome, --pronounceable or --hunt-words\n")
+		os.Exit(1)
+	case !searching && benchmark == 0:
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	var targetSequence string
-	var caseInsensitive bool
+	// Literal targets may also be given as a comma-separated list; regular
+	// expressions are left intact since commas are valid in repetitions
+	var targets []string
+	for _, arg := range args {
+		if useRegex {
+			targets = append(targets, arg)
+		} else {
+			targets = append(targets, strings.Split(arg, ",")...)
+		}
+	}
 
-	if len(os.Args) == 3 {
-		if os.Args[1] != "--ci" {
-			fmt.Fprintf(os.Stderr, "Usage: %s [--ci] <target_sequence>\n", os.Args[0])
-			fmt.Fprintf(os.Stderr, "  --ci: Enable case-insensitive search\n")
+	// Targets given with --target may override --ci one by one
+	var targetCases []vanity.Case
+	if len(targetSpecs) > 0 {
+		targetCases = make([]vanity.Case, len(targets))
+		for _, spec := range targetSpecs {
+			target, targetCase := parseTargetSpec(spec)
+			targets = append(targets, target)
+			targetCases = append(targetCases, targetCase)
+		}
+	}
+
+	// Numbers from --number-range follow, from rangeStart on, and are
+	// announced as their ranges rather than one by one
+	rangeStart := len(targets)
+	for _, spec := range rangeSpecs {
+		numbers, err := parseNumberRange(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		targets = append(targets, numbers...)
+		if len(targets)-rangeStart > maxRangeNumbers {
+			fmt.Fprintf(os.Stderr, "Error: --number-range expands to more than %d numbers; narrow the ranges\n", maxRangeNumbers)
+			os.Exit(1)
+		}
+	}
+	rangeEnd := len(targets)
+	if len(rangeSpecs) > 0 && requireAll {
+		fmt.Fprintf(os.Stderr, "Error: --all would require every number of --number-range at once\n")
+		os.Exit(1)
+	}
+
+	// Targets given with --score carry their own weight; the others weigh
+	// one each
+	var weights []int
+	if len(scoreSpecs) > 0 {
+		if minScore == 0 {
+			fmt.Fprintf(os.Stderr, "Error: --score weights only count with --min-score\n")
+			os.Exit(1)
+		}
+		for range targets {
+			weights = append(weights, 1)
+		}
+		for _, spec := range scoreSpecs {
+			target, weight, err := parseScoreSpec(spec)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			targets = append(targets, target)
+			weights = append(weights, weight)
+		}
+	}
+
+	var fingerprintTargets []string
+	for _, spec := range fingerprintSpecs {
+		if useRegex {
+			fingerprintTargets = append(fingerprintTargets, spec)
+		} else {
+			fingerprintTargets = append(fingerprintTargets, strings.Split(spec, ",")...)
+		}
+	}
+
+	// Targets from --wordlist come last, from listStart on
+	listStart := -1
+
+	// A word hunt draws from the built-in dictionary unless given its own
+	var huntList []string
+	if huntWords {
+		huntList = vanity.EnglishWords()
+	}
+	if wordlist != "" {
+		words, err := readWordlist(wordlist)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading wordlist: %v\n", err)
+			os.Exit(1)
+		}
+		if len(words) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: wordlist %s contains no targets\n", wordlist)
+			os.Exit(1)
+		}
+		if huntWords {
+			huntList = words
+		} else {
+			listStart = len(targets)
+			targets = append(targets, words...)
+		}
+	}
+
+	// Keys are only blocked when asked for, with the built-in list, a file
+	// of words or both
+	var blocklist []string
+	if blockProfanity {
+		blocklist = vanity.DefaultBlocklist()
+	}
+	if blocklistFile != "" {
+		words, err := readWordlist(blocklistFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading blocklist: %v\n", err)
+			os.Exit(1)
+		}
+		blocklist = append(blocklist, words...)
+	}
+
+	var startRange *vanity.Range
+	if startRangeSpec != "" {
+		var err error
+		if startRange, err = parseStartRange(startRangeSpec); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var run *vanity.Run
+	if runSpec != "" {
+		var err error
+		run, err = parseRun(runSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(targets) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: --run replaces the target sequences; give one or the other\n")
 			os.Exit(1)
 		}
-		caseInsensitive = true
-		targetSequence = os.Args[2]
-	} else {
-		targetSequence = os.Args[1]
 	}
 
-	if targetSequence == "" {
-		fmt.Fprintf(os.Stderr, "Error: target sequence cannot be empty\n")
+	if palindrome != 0 && (len(targets) > 0 || run != nil) {
+		fmt.Fprintf(os.Stderr, "Error: --palindrome replaces the target sequences and --run; give only one of them\n")
+		os.Exit(1)
+	}
+	if pronounceable != 0 && (len(targets) > 0 || run != nil || palindrome != 0) {
+		fmt.Fprintf(os.Stderr, "Error: --pronounceable replaces the target sequences, --run and --palindrome; give only one of them\n")
 		os.Exit(1)
 	}
 
-	numWorkers := runtime.NumCPU() * 3
+	// Each job brings its own targets, case, comment and key files
+	var jobs []jobSpec
+	if jobsFile != "" {
+		switch {
+		case len(targets) > 0 || run != nil || palindrome != 0 || pronounceable != 0 || huntWords || minScore > 0:
+			fmt.Fprintf(os.Stderr, "Error: --jobs gives the targets of every key and cannot be combined with other targets, --run, --palindrome, --pronounceable, --hunt-words or --min-score\n")
+			os.Exit(1)
+		case count > 1 || toStdout || bestEffort:
+			fmt.Fprintf(os.Stderr, "Error: --jobs writes one key per job and cannot be combined with --count, --stdout or --best\n")
+			os.Exit(1)
+		}
+		var err error
+		if jobs, err = readJobs(jobsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading jobs: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	searchType := "case-sensitive"
-	if caseInsensitive {
-		searchType = "case-insensitive"
+	var art []vanity.ArtCell
+	for _, spec := range artSpecs {
+		cell, err := parseArtCell(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		art = append(art, cell)
 	}
-	fmt.Printf("Searching for ed25519 key containing: %s (%s)\n", targetSequence, searchType)
-	fmt.Printf("Using %d cores, %d workers\n", runtime.NumCPU(), numWorkers)
 
-	resultChan := make(chan Result, 1)
-	done := make(chan struct{})
+	var charsets []vanity.CharsetRegion
+	for _, spec := range charsetSpecs {
+		region, err := parseCharsetRegion(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		charsets = append(charsets, region)
+	}
 
-	var totalAttempts uint64
-	var wg sync.WaitGroup
+	// An explicitly empty --passphrase asks for one before the search starts,
+	// so nobody has to wait around for it
+	passphraseSet, maxGapsSet := false, false
+	flag.Visit(func(f *flag.Flag) {
+		passphraseSet = passphraseSet || f.Name == "passphrase"
+		maxGapsSet = maxGapsSet || f.Name == "max-gaps"
+	})
+	if passphraseSet && keyFormat == "pkcs8" {
+		fmt.Fprintf(os.Stderr, "Error: --format pkcs8 writes unencrypted keys and cannot take a --passphrase\n")
+		os.Exit(1)
+	}
+	if passphraseSet && passphrase == "" && !estimate && !dryRun && benchmark == 0 {
+		var err error
+		passphrase, err = promptPassphrase()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	// Start progress reporter
-	go func() {
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
+	keyFile := "id_" + keyTypeName
+	if outPath != "" {
+		var err error
+		keyFile, err = expandHome(outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-		lastAttempts := uint64(0)
-		startTime := time.Now()
+	if authorizedPath != "" {
+		var err error
+		authorizedPath, err = expandHome(authorizedPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if toStdout && outPath != "" {
+		fmt.Fprintf(os.Stderr, "Error: --stdout and --out cannot be used together\n")
+		os.Exit(1)
+	}
+
+	if count < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --count must be at least 1\n")
+		os.Exit(1)
+	}
 
-		for {
-			select {
-			case <-done:
-				return
-			case <-ticker.C:
-				current := atomic.LoadUint64(&totalAttempts)
-				rate := current - lastAttempts
-				elapsed := time.Since(startTime)
-				avgRate := float64(current) / elapsed.Seconds()
+	// PuTTY expects its own extension on the private key; the public key
+	// keeps the OpenSSH name and format for authorized_keys
+	var privateSuffix string
+	switch keyFormat {
+	case "openssh", "pkcs8":
+	case "ppk":
+		privateSuffix = ".ppk"
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --format must be openssh, pkcs8 or ppk, not %q\n", keyFormat)
+		os.Exit(1)
+	}
 
-				fmt.Printf("\rAttempts: %d | Rate: %d/s | Avg: %.0f/s | Elapsed: %s",
-					current, rate, avgRate, elapsed.Truncate(time.Second))
-				lastAttempts = current
+	var modes keyModes
+	var err error
+	if modes.private, err = parseFileMode("--key-mode", keyModeText); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if modes.public, err = parseFileMode("--pub-mode", pubModeText); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// Allowed for keys kept on shared storage, but ssh itself refuses a
+	// private key that group or others can read
+	if modes.private&^0600 != 0 {
+		fmt.Fprintf(info, "Warning: --key-mode %04o is broader than 0600; ssh refuses to use a private key others can access\n", modes.private)
+	}
+
+	if jobs != nil {
+		if err := resolveJobPaths(jobs, keyFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// A key found for one of several targets is named after the target it
+	// holds, so the keys of repeated runs can be told apart and kept side by
+	// side
+	var patternFiles map[string]string
+	if len(targets) > 1 && !requireAll && minScore == 0 && count == 1 && jobs == nil && !toStdout {
+		patternFiles = patternKeyFiles(keyFile, targets)
+	}
+
+	// Never clobber a real key by accident, and check up front rather than
+	// after a long search
+	if !force && !toStdout && !estimate && benchmark == 0 {
+		paths := []string{keyFile + privateSuffix, keyFile + ".pub"}
+		if patternFiles != nil {
+			paths = nil
+			for _, target := range targets {
+				paths = append(paths, patternFiles[target]+privateSuffix, patternFiles[target]+".pub")
 			}
 		}
-	}()
+		if jobs != nil {
+			paths = nil
+			for _, job := range jobs {
+				paths = append(paths, job.Out+privateSuffix, job.Out+".pub")
+			}
+		}
+		if count > 1 {
+			paths = nil
+			for i := 1; i <= count; i++ {
+				paths = append(paths, numberedKeyFile(keyFile, i)+privateSuffix, numberedKeyFile(keyFile, i)+".pub")
+			}
+		}
+		if existing := existingFile(paths...); existing != "" {
+			fmt.Fprintf(os.Stderr, "Error: %s already exists; use --force to overwrite it\n", existing)
+			os.Exit(1)
+		}
+	}
+
+	if strings.ContainsAny(comment, "\r\n") {
+		fmt.Fprintf(os.Stderr, "Error: --comment cannot contain line breaks\n")
+		os.Exit(1)
+	}
+
+	// --anchor spells out the modes --prefix and --suffix select, and adds
+	// either of the two
+	var either bool
+	switch anchor {
+	case "":
+	case "start", "end", "either", "any":
+		if prefix || suffix || at >= 0 {
+			fmt.Fprintf(os.Stderr, "Error: --anchor cannot be combined with --prefix, --suffix or --at\n")
+			os.Exit(1)
+		}
+		prefix, suffix, either = anchor == "start", anchor == "end", anchor == "either"
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --anchor must be start, end, either or any, not %q\n", anchor)
+		os.Exit(1)
+	}
 
-	// Start workers
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go worker(i, targetSequence, caseInsensitive, &totalAttempts, resultChan, done, &wg)
+	if prefix && suffix {
+		fmt.Fprintf(os.Stderr, "Error: --prefix and --suffix cannot be used together\n")
+		os.Exit(1)
 	}
 
-	// Wait for result
-	result := <-resultChan
-	close(done)
-	wg.Wait()
+	if at >= 0 && (prefix || suffix) {
+		fmt.Fprintf(os.Stderr, "Error: --at cannot be combined with --prefix or --suffix\n")
+		os.Exit(1)
+	}
 
-	fmt.Printf("\n\nMatch found after %d attempts!\n", result.attempts)
+	var seed *uint64
+	if seedSpec != "" {
+		n, err := strconv.ParseUint(seedSpec, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --seed must be a non-negative integer, not %q\n", seedSpec)
+			os.Exit(1)
+		}
+		seed = &n
+	}
 
-	// Write private key
-	privateKeyPEM, err := ssh.MarshalPrivateKey(result.privateKey, "")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error marshaling private key: %v\n", err)
+	if verbose && quiet {
+		fmt.Fprintf(os.Stderr, "Error: --verbose and --quiet cannot be used together\n")
 		os.Exit(1)
 	}
 
-	privateKeyBytes := pem.EncodeToMemory(privateKeyPEM)
-	err = os.WriteFile("id_ed25519", privateKeyBytes, 0600)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing private key: %v\n", err)
+	if workers < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --workers must be positive\n")
 		os.Exit(1)
 	}
+	if workers == 0 {
+		workers = vanity.DefaultWorkers()
+	}
 
-	// Write public key
-	err = os.WriteFile("id_ed25519.pub", []byte(result.sshPubKey), 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing public key: %v\n", err)
+	if last != 0 && (prefix || suffix || at >= 0) {
+		fmt.Fprintf(os.Stderr, "Error: --last cannot be combined with --prefix, --suffix or --at\n")
 		os.Exit(1)
 	}
 
-	fmt.Printf("Keys written to id_ed25519 and id_ed25519.pub\n")
-	fmt.Printf("Public key: %s\n", strings.TrimSpace(result.sshPubKey))
+	var keyType vanity.KeyType
+	var curve elliptic.Curve
+	keyName := keyTypeName
+	switch keyTypeName {
+	case "ed25519":
+		keyType = vanity.KeyEd25519
+	case "rsa":
+		keyType = vanity.KeyRSA
+		if bits == 0 {
+			bits = vanity.DefaultRSABits
+		}
+		keyName = fmt.Sprintf("%d-bit RSA", bits)
+	case "ecdsa":
+		keyType = vanity.KeyECDSA
+		switch curveName {
+		case "", "p256":
+			curve = elliptic.P256()
+		case "p384":
+			curve = elliptic.P384()
+		case "p521":
+			curve = elliptic.P521()
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown curve %q; use p256, p384 or p521\n", curveName)
+			os.Exit(1)
+		}
+		keyName = "ECDSA " + curve.Params().Name
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown key type %q; use ed25519, rsa or ecdsa\n", keyTypeName)
+		os.Exit(1)
+	}
 
-	finalAttempts := atomic.LoadUint64(&totalAttempts)
-	fmt.Printf("Total attempts across all workers: %d\n", finalAttempts)
-}
+	if curveName != "" && keyType != vanity.KeyECDSA {
+		fmt.Fprintf(os.Stderr, "Error: --curve only applies to --type ecdsa\n")
+		os.Exit(1)
+	}
+
+	// Symbols are only skipped when asked for, however many are allowed
+	squashGaps := 0
+	switch {
+	case maxGapsSet && !squashSymbols:
+		fmt.Fprintf(os.Stderr, "Error: --max-gaps only applies to --squash-symbols\n")
+		os.Exit(1)
+	case squashSymbols && maxGaps < 1:
+		fmt.Fprintf(os.Stderr, "Error: --max-gaps must be at least 1\n")
+		os.Exit(1)
+	case squashSymbols:
+		squashGaps = maxGaps
+	}
+
+	if bodyOnly && fullLine {
+		fmt.Fprintf(os.Stderr, "Error: --body-only and --match-full-line cannot be used together\n")
+		os.Exit(1)
+	}
+
+	// By default only the random part of the key is searched, so targets such
+	// as "ssh" or "AAAA" cannot trivially match the fixed text around it
+	scope := vanity.ScopeVariable
+	if bodyOnly {
+		scope = vanity.ScopeBody
+	} else if fullLine {
+		scope = vanity.ScopeLine
+	}
+
+	fieldFlags := 0
+	for _, set := range []bool{fingerprint, fingerprintMD5, bubbleBabble, hexKey} {
+		if set {
+			fieldFlags++
+		}
+	}
+	if fieldFlags > 1 {
+		fmt.Fprintf(os.Stderr, "Error: only one of --fingerprint, --fingerprint-md5, --bubblebabble and --hex can be used\n")
+		os.Exit(1)
+	}
+
+	if fieldFlags > 0 && (bodyOnly || fullLine) {
+		fmt.Fprintf(os.Stderr, "Error: --body-only and --match-full-line only apply to public key searches\n")
+		os.Exit(1)
+	}
 
-func worker(id int, targetSequence string, caseInsensitive bool, totalAttempts *uint64, resultChan chan Result, done chan struct{}, wg *sync.WaitGroup) {
-	defer wg.Done()
+	field := vanity.FieldKey
+	fieldName := "key"
+	if fingerprint {
+		field = vanity.FieldFingerprint
+		fieldName = "fingerprint"
+	} else if fingerprintMD5 {
+		field = vanity.FieldMD5Fingerprint
+		fieldName = "MD5 fingerprint"
+	} else if bubbleBabble {
+		field = vanity.FieldBubbleBabble
+		fieldName = "Bubble Babble digest"
+	} else if hexKey {
+		field = vanity.FieldHex
+		fieldName = "hex public key"
+	}
 
-	attempts := uint64(0)
-	batchSize := uint64(1000) // Smaller batches to reduce memory pressure
+	mode := vanity.ModeAnywhere
+	if prefix {
+		mode = vanity.ModePrefix
+	} else if suffix {
+		mode = vanity.ModeSuffix
+	} else if at >= 0 {
+		mode = vanity.ModeAt
+	} else if either {
+		mode = vanity.ModeEither
+	}
 
-	var targetBytes []byte
+	var totalAttempts uint64
+	var rejected uint64
+	var blocked uint64
+	var avoided uint64
+	var topScore int64
+	var workerAttempts []uint64
+	if verbose {
+		workerAttempts = make([]uint64, workers)
+	}
+	opts := vanity.Options{
+		KeyType:            keyType,
+		Bits:               bits,
+		Curve:              curve,
+		Targets:            targets,
+		TargetCases:        targetCases,
+		FingerprintTargets: fingerprintTargets,
+		FingerprintRegex:   fingerprintRegex,
+		MinScore:           minScore,
+		Delimited:          delimitedMatch,
+		Weights:            weights,
+		TopScore:           &topScore,
+		Run:                run,
+		Palindrome:         palindrome,
+		Pronounceable:      pronounceable,
+		Randomart:          art,
+		Charsets:           charsets,
+		Field:              field,
+		CaseInsensitive:    caseInsensitive,
+		SmartCase:          smartCase,
+		Confusables:        confusables,
+		Regex:              useRegex,
+		RequireAll:         requireAll,
+		Mode:               mode,
+		Scope:              scope,
+		At:                 at,
+		Last:               last,
+		Range:              startRange,
+		MinCount:           minCount,
+		MaxMismatch:        maxMismatch,
+		MaxGaps:            squashGaps,
+		Subsequence:        subsequence,
+		CaseBudget:         caseBudget,
+		Exclude:            excludes,
+		Workers:            workers,
+		BatchSize:          batchSize,
+		MaxAttempts:        maxAttempts,
+		Seed:               seed,
+		Attempts:           &totalAttempts,
+		Rejected:           &rejected,
+		Blocklist:          blocklist,
+		Blocked:            &blocked,
+		Avoid:              avoid,
+		Avoided:            &avoided,
+		WorkerAttempts:     workerAttempts,
+	}
+	if bestEffort || huntWords {
+		opts.Best = new(vanity.BestEffort)
+	}
+	opts.Words = huntList
+
+	if listStart >= 0 {
+		opts.Targets = skipImpossible(opts, listStart, wordlist)
+		targets = opts.Targets
+	}
+
+	if benchmark > 0 {
+		os.Exit(runBenchmark(opts, keyName, benchmark, summaryJSON, info, report))
+	}
+
+	if jobs != nil {
+		os.Exit(runJobs(jobRun{
+			opts:           opts,
+			keyName:        keyName,
+			jobs:           jobs,
+			comment:        comment,
+			format:         keyFormat,
+			privateSuffix:  privateSuffix,
+			passphrase:     passphrase,
+			modes:          modes,
+			authorizedPath: authorizedPath,
+			jsonOut:        jsonOut,
+			summaryJSON:    summaryJSON,
+			timeout:        timeout,
+			maxAttempts:    maxAttempts,
+			quiet:          quiet,
+			estimate:       estimate || dryRun,
+			info:           info,
+			report:         report,
+		}))
+	}
+
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	searchType := "case-sensitive"
 	if caseInsensitive {
-		targetBytes = []byte(strings.ToLower(targetSequence))
+		searchType = "case-insensitive"
+	}
+	if smartCase {
+		searchType = "smart case"
+	}
+	if caseBudget == 1 {
+		searchType = "case-insensitive, at most one letter in another case"
+	} else if caseBudget > 1 {
+		searchType = fmt.Sprintf("case-insensitive, at most %d letters in another case", caseBudget)
+	}
+	if confusables {
+		searchType += ", look-alike characters allowed"
+	}
+	if delimitedMatch {
+		searchType += ", set off from its neighbours"
+	}
+	if maxMismatch > 0 {
+		if maxMismatch == 1 {
+			searchType += ", one mismatched character allowed"
+		} else {
+			searchType += fmt.Sprintf(", up to %d mismatched characters allowed", maxMismatch)
+		}
+	}
+	if squashGaps == 1 {
+		searchType += ", one '+' or '/' skipped"
+	} else if squashGaps > 1 {
+		searchType += fmt.Sprintf(", up to %d '+' or '/' skipped", squashGaps)
+	}
+	description := "containing"
+	switch {
+	case mode == vanity.ModePrefix:
+		description = "starting with"
+	case mode == vanity.ModeSuffix:
+		description = "ending with"
+	case mode == vanity.ModeAt:
+		description = fmt.Sprintf("containing at position %d", at)
+	case mode == vanity.ModeEither:
+		description = "starting or ending with"
+	case useRegex:
+		description = "matching"
+	case subsequence:
+		description = "containing in order the characters of"
+	}
+	if last > 0 {
+		description += fmt.Sprintf(" in the last %d characters", last)
+	}
+	if startRange != nil {
+		description += fmt.Sprintf(" starting at offsets %d to %d", startRange.Start, startRange.End-1)
+	}
+	if minCount > 1 {
+		description += fmt.Sprintf(" at least %d times", minCount)
+	}
+	if minScore > 0 {
+		description += fmt.Sprintf(" targets worth at least %d out of", minScore)
+	} else if len(targets) > 1 {
+		if requireAll {
+			description += " all of"
+		} else {
+			description += " any of"
+		}
+	}
+	// Said even under --quiet, since the key must not end up in use
+	if seed != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: --seed %d makes keys anyone can regenerate from the seed; never use them as real credentials\n", *seed)
+	}
+
+	if huntWords {
+		fmt.Fprintf(info, "Hunting for %s %s holding the longest of %d words (%s)\n", keyName, fieldName, len(huntList), searchType)
+	} else if run != nil {
+		fmt.Fprintf(info, "Searching for %s %s %s a run of %s (%s)\n", keyName, fieldName, description, run, searchType)
+	} else if palindrome != 0 {
+		fmt.Fprintf(info, "Searching for %s %s %s a palindrome of at least %d characters (%s)\n", keyName, fieldName, description, palindrome, searchType)
+	} else if pronounceable != 0 {
+		fmt.Fprintf(info, "Searching for %s %s ending in %d pronounceable characters\n", keyName, fieldName, pronounceable)
+	} else if len(targets) == 0 && len(charsets) == 0 && (len(fingerprintTargets) > 0 || fingerprintRegex != "") {
+		fmt.Fprintf(info, "Searching for %s key by fingerprint alone\n", keyName)
+	} else if len(targets) == 0 && len(charsets) == 0 {
+		fmt.Fprintf(info, "Searching for %s key by randomart alone\n", keyName)
+	} else if len(targets) == 0 {
+		fmt.Fprintf(info, "Searching for %s %s by character classes\n", keyName, fieldName)
+	} else if wordlist != "" {
+		fmt.Fprintf(info, "Searching for %s %s %s %d targets from %s (%s)\n", keyName, fieldName, description, len(targets), wordlist, searchType)
 	} else {
-		targetBytes = []byte(targetSequence)
+		// Targets overriding --ci say so
+		var labels []string
+		for i, target := range targets {
+			if i == rangeStart {
+				for _, spec := range rangeSpecs {
+					low, high, _ := strings.Cut(spec, ":")
+					labels = append(labels, fmt.Sprintf("any number from %s to %s", low, high))
+				}
+			}
+			if i >= rangeStart && i < rangeEnd {
+				continue
+			}
+			label := target
+			if smartCase {
+				// Say what each target turned out to be
+				if opts.IgnoresCase(i) {
+					label += " (case-insensitive)"
+				} else {
+					label += " (case-sensitive)"
+				}
+			} else if i < len(targetCases) && targetCases[i] != vanity.CaseDefault && (targetCases[i] == vanity.CaseInsensitive) != caseInsensitive {
+				label += " (" + targetCases[i].String() + ")"
+			}
+			if minScore > 0 {
+				label += fmt.Sprintf(" = %d", weightOf(weights, i))
+			}
+			labels = append(labels, label)
+		}
+		fmt.Fprintf(info, "Searching for %s %s %s: %s (%s)\n", keyName, fieldName, description, strings.Join(labels, ", "), searchType)
+	}
+	if len(fingerprintTargets) > 0 {
+		joiner := "any of"
+		if requireAll {
+			joiner = "all of"
+		}
+		if len(fingerprintTargets) == 1 {
+			joiner = "containing"
+		}
+		fmt.Fprintf(info, "Requiring a fingerprint %s: %s\n", joiner, strings.Join(fingerprintTargets, ", "))
+	}
+	if fingerprintRegex != "" {
+		fmt.Fprintf(info, "Requiring a fingerprint matching: %s\n", fingerprintRegex)
+		// With nothing to rule a key out first, every candidate is hashed
+		// and run through the expression
+		if len(targets) == 0 && len(charsets) == 0 && run == nil && palindrome == 0 && pronounceable == 0 && field != vanity.FieldFingerprint {
+			fmt.Fprintf(info, "Note: every key is hashed and checked against the fingerprint expression, which is slower than matching the key alone\n")
+		}
+	}
+	if len(excludes) > 0 {
+		fmt.Fprintf(info, "Excluding: %s\n", strings.Join(excludes, ", "))
+	}
+	if len(blocklist) > 0 {
+		var sources []string
+		if blockProfanity {
+			sources = append(sources, "the built-in list of profanities")
+		}
+		if blocklistFile != "" {
+			sources = append(sources, blocklistFile)
+		}
+		fmt.Fprintf(info, "Blocking keys showing a word of %s (%d words)\n", strings.Join(sources, " and "), len(blocklist))
+	}
+	if avoid != "" {
+		fmt.Fprintf(info, "Avoiding anywhere in the key: %s\n", avoid)
+		// Every avoided character has dozens of chances to turn up, so even
+		// a few of them reject most keys that match
+		plain := opts
+		plain.Avoid = ""
+		if expected, ok := opts.ExpectedAttempts(); ok {
+			if without, ok := plain.ExpectedAttempts(); ok {
+				fmt.Fprintf(info, "Warning: avoiding %d characters rejects about %.0f%% of matching keys, so the search takes about %.3gx as long\n", len(avoid), (1-without/expected)*100, expected/without)
+			}
+		}
+	}
+	for _, region := range charsets {
+		fmt.Fprintf(info, "Requiring %s\n", region)
+	}
+	for _, cell := range art {
+		fmt.Fprintf(info, "Randomart must show %s\n", cell)
+	}
+	fmt.Fprintf(info, "Using %d cores, %d workers\n", runtime.NumCPU(), opts.Workers)
+	if expected, ok := opts.ExpectedAttempts(); ok && !estimate {
+		fmt.Fprintf(info, "Expected attempts: ~%.0f\n", expected)
+		// Each extra occurrence costs as much again as the first, which
+		// adds up faster than people expect
+		if minCount > 1 && expected > unreachableAttempts {
+			fmt.Fprintf(info, "Warning: requiring %d occurrences of a target longer than about 3 characters is essentially unreachable on a desktop\n", minCount)
+		}
 	}
 
-	for {
-		// Check for shutdown signal less frequently
-		select {
-		case <-done:
+	if dryRun {
+		printPlan(info, opts, keyFile, privateSuffix, patternFiles, count, toStdout, authorizedPath, timeout)
+		return
+	}
+
+	if suggest {
+		if len(targets) != 1 || useRegex || strings.ContainsAny(targets[0], "?*[\\") {
+			fmt.Fprintf(os.Stderr, "Error: suggest takes a single literal target, without wildcards or classes\n")
+			os.Exit(1)
+		}
+		if err := printSuggestions(opts, targets[0], confirmOver); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if estimate {
+		if err := printEstimate(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// A search bounded by --timeout or --max-attempts cannot run away
+	if !yes && confirmOver > 0 && timeout == 0 && maxAttempts == 0 {
+		if err := confirmExpensive(opts, confirmOver); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Ctrl-C or SIGTERM cancels the search so the statistics below still get
+	// printed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	progressLabel := ""
+	if field != vanity.FieldKey {
+		progressLabel = strings.ToUpper(fieldName[:1]) + fieldName[1:] + " search | "
+	}
+	startTime := time.Now()
+
+	// --summary-json ends every search that ran with one line for metrics,
+	// whatever came of it
+	summaryTarget := strings.Join(targets, ",")
+	if runSpec != "" {
+		summaryTarget = runSpec
+	}
+	summarize := func(matched bool) {
+		if !summaryJSON {
 			return
-		default:
 		}
+		summary := jsonSummary{
+			TotalAttempts:   atomic.LoadUint64(&totalAttempts),
+			Workers:         opts.Workers,
+			Target:          summaryTarget,
+			Matched:         matched,
+			CaseInsensitive: caseInsensitive,
+		}
+		if err := writeSummaryJSON(os.Stderr, summary, time.Since(startTime)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON summary: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-		// Process a batch without checking done channel for maximum performance
-		for i := uint64(0); i < batchSize; i++ {
-			// Generate ed25519 keypair directly
-			pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
-			if err != nil {
-				continue
+	// The progress line is drawn from the search's own reporter, unless
+	// --quiet keeps the terminal clean
+	if !quiet {
+		lastAttempts := uint64(0)
+		lastTick := time.Now()
+		expected, estimable := opts.ExpectedAttempts()
+		ticks := 0
+
+		opts.OnProgress = func(current uint64, elapsed time.Duration) {
+			// Worker counts get a line of their own above the progress
+			// line, which carries on below them
+			ticks++
+			if verbose && ticks%verboseTicks == 0 {
+				fmt.Fprintf(os.Stderr, "\n%s\n", workerSummary(workerAttempts))
 			}
 
-			attempts++
+			// Reports are late and skipped under load, so the rate
+			// divides by the time that actually passed since the last
+			// count
+			now := time.Now()
+			rate := float64(current-lastAttempts) / now.Sub(lastTick).Seconds()
+			avgRate := float64(current) / elapsed.Seconds()
 
-			// Convert to SSH format - this is the expensive operation
-			sshPubKey, err := ssh.NewPublicKey(pubKey)
-			if err != nil {
-				continue
+			// The remaining expected attempts at the average rate so
+			// far. Keys are independent, so a search running late is no
+			// closer to the end than when it started.
+			eta := "unknown"
+			switch {
+			case estimable && float64(current) >= expected:
+				eta = "overdue"
+			case estimable && avgRate > 0:
+				eta = formatSeconds((expected - float64(current)) / avgRate)
 			}
 
-			// Get bytes directly to avoid string allocation
-			sshPubKeyBytes := ssh.MarshalAuthorizedKey(sshPubKey)
+			// Padded so a shorter ETA overwrites a longer one
+			fmt.Fprintf(os.Stderr, "\r%sAttempts: %d | Rate: %.0f/s | Avg: %.0f/s | Elapsed: %s | ETA: %-13s",
+				progressLabel, current, rate, avgRate, elapsed.Truncate(time.Second), eta)
+			if len(excludes) > 0 {
+				fmt.Fprintf(os.Stderr, " | Rejected: %d", atomic.LoadUint64(&rejected))
+			}
+			if n := atomic.LoadUint64(&blocked); n > 0 {
+				fmt.Fprintf(os.Stderr, " | Blocked: %d", n)
+			}
+			if avoid != "" {
+				fmt.Fprintf(os.Stderr, " | Avoided: %d", atomic.LoadUint64(&avoided))
+			}
+			if minScore > 0 {
+				fmt.Fprintf(os.Stderr, " | Top score: %d", atomic.LoadInt64(&topScore))
+			}
+			if best := opts.Best; best != nil {
+				if r := best.Result(); r != nil {
+					match := r.Matches[0]
+					if huntWords {
+						fmt.Fprintf(os.Stderr, " | Longest word: %s (%d letters)", match.Target, len(match.Target))
+					} else {
+						fmt.Fprintf(os.Stderr, " | Best: %q", searchedText(r, match.Field)[match.Start:match.End])
+					}
+				}
+			}
+			lastAttempts, lastTick = current, now
+		}
+	}
+
+	results, err := vanity.SearchN(ctx, opts, count)
+	stopped := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, vanity.ErrMaxAttempts)
+	if err != nil && !stopped {
+		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		os.Exit(1)
+	}
 
-			var match bool
-			if caseInsensitive {
-				match = containsBytesIgnoreCase(sshPubKeyBytes, targetBytes)
+	// Keys short of --count are still written, then the search reports how
+	// it stopped
+	exitStatus := 0
+	if stopped {
+		var reason string
+		var status int
+		switch {
+		case errors.Is(err, vanity.ErrMaxAttempts):
+			reason = fmt.Sprintf("Reached the limit of %d attempts", maxAttempts)
+			status = exitMaxAttempts
+		case errors.Is(err, context.DeadlineExceeded):
+			reason = fmt.Sprintf("Timed out after %s", timeout)
+			status = exitTimeout
+		default:
+			reason = "Search interrupted"
+			status = exitInterrupted
+		}
+
+		// No key files are written when the search is cut short, unless a
+		// best-effort search has a near miss to keep
+		if len(results) == 0 {
+			elapsed := time.Since(startTime)
+			finalAttempts := atomic.LoadUint64(&totalAttempts)
+
+			// Still said under --quiet, since nothing else will be
+			gap := "\n\n"
+			if quiet {
+				gap = ""
+			}
+			if huntWords {
+				fmt.Fprintf(os.Stderr, "%s%s, no word found\n", gap, reason)
+			} else if bestEffort {
+				fmt.Fprintf(os.Stderr, "%s%s, not even part of the target found\n", gap, reason)
 			} else {
-				match = containsBytes(sshPubKeyBytes, targetBytes)
-			}
-
-			if match {
-				// Only convert to string when we have a match
-				sshPubKeyString := string(sshPubKeyBytes)
-
-				select {
-				case resultChan <- Result{
-					privateKey: privKey,
-					publicKey:  pubKey,
-					sshPubKey:  sshPubKeyString,
-					attempts:   atomic.LoadUint64(totalAttempts) + attempts,
-				}:
-					return
-				case <-done:
-					return
+				fmt.Fprintf(os.Stderr, "%s%s, no match found\n", gap, reason)
+			}
+			fmt.Fprintf(info, "Total attempts across all workers: %d\n", finalAttempts)
+			if len(excludes) > 0 {
+				fmt.Fprintf(info, "Matches rejected for an excluded sequence: %d\n", atomic.LoadUint64(&rejected))
+			}
+			if len(blocklist) > 0 {
+				fmt.Fprintf(info, "Matches rejected by the blocklist: %d\n", atomic.LoadUint64(&blocked))
+			}
+			if avoid != "" {
+				fmt.Fprintf(info, "Matches rejected for an avoided character: %d\n", atomic.LoadUint64(&avoided))
+			}
+			fmt.Fprintf(info, "Average rate: %.0f/s | Elapsed: %s\n", float64(finalAttempts)/elapsed.Seconds(), elapsed.Truncate(time.Second))
+			summarize(false)
+			os.Exit(status)
+		}
+		if count > 1 {
+			fmt.Fprintf(info, "\n\n%s, keeping the %d of %d keys found\n", reason, len(results), count)
+			exitStatus = status
+		} else {
+			kept := "the closest match"
+			if huntWords {
+				kept = "the longest word"
+			}
+			fmt.Fprintf(info, "\n\n%s, keeping %s, found after %d attempts\n", reason, kept, results[0].Attempts)
+		}
+	} else if count > 1 {
+		fmt.Fprintf(info, "\n\nAll %d matches found!\n", count)
+	} else {
+		fmt.Fprintf(info, "\n\nMatch found after %d attempts!\n", results[0].Attempts)
+	}
+
+	for i, result := range results {
+		// Every key of a --count search gets files of its own
+		path := keyFile
+		if patternFiles != nil && len(result.Matches) > 0 {
+			path = patternFiles[result.Matches[0].Target]
+		}
+		if count > 1 {
+			path = numberedKeyFile(keyFile, i+1)
+			fmt.Fprintf(info, "\nKey %d of %d, found after %d attempts\n", i+1, len(results), result.Attempts)
+		}
+
+		// Write private key
+		privatePath := path + privateSuffix
+		privateKeyBytes, err := marshalPrivateKey(result.PrivateKey, keyFormat, comment, passphrase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling private key: %v\n", err)
+			os.Exit(1)
+		}
+		pubKeyLine := publicKeyLine(result, comment)
+
+		if toStdout {
+			// A marker line of its own separates the private key from the
+			// public key line, unless both go into the JSON object instead
+			if !jsonOut {
+				fmt.Printf("%s\n%s\n%s\n", strings.TrimRight(string(privateKeyBytes), "\n"), stdoutSeparator, pubKeyLine)
+			}
+		} else {
+			if err := writeKeyFiles(privatePath, path+".pub", privateKeyBytes, pubKeyLine, modes); err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(report, "Keys written to %s and %s.pub\n", privatePath, path)
+		}
+		if authorizedPath != "" {
+			if err := appendLine(authorizedPath, pubKeyLine); err != nil {
+				fmt.Fprintf(os.Stderr, "Error appending to %s: %v\n", authorizedPath, err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(report, "Public key appended to %s\n", authorizedPath)
+		}
+		fmt.Fprintf(report, "Public key: %s\n", pubKeyLine)
+		// The same SHA256 fingerprint ssh-keygen -l shows, to check the key by
+		fmt.Fprintf(report, "Fingerprint: %s\n", result.Fingerprint)
+
+		switch field {
+		case vanity.FieldMD5Fingerprint:
+			fmt.Fprintf(report, "MD5 fingerprint: %s\n", result.MD5Fingerprint)
+		case vanity.FieldBubbleBabble:
+			fmt.Fprintf(report, "Bubble Babble: %s\n", result.BubbleBabble)
+		case vanity.FieldHex:
+			fmt.Fprintf(report, "Public key hex: %s\n", result.PublicKeyHex)
+		}
+
+		if len(art) > 0 {
+			fmt.Fprint(report, result.Randomart)
+		}
+
+		for i, match := range result.Matches {
+			matchText := searchedText(result, match.Field)[match.Start:match.End]
+			// The fingerprint expression always comes last
+			if fingerprintRegex != "" && i == len(result.Matches)-1 {
+				fmt.Fprintf(report, "Fingerprint matches %s:\n", match.Target)
+				printHighlight(report, result.Fingerprint, match.Start, match.End)
+				continue
+			}
+			if match.Field != field {
+				// Only fingerprint targets search another field
+				fmt.Fprintf(report, "Matched fingerprint target: %s (%q at offset %d)\n", match.Target, matchText, matchOffset(result, match))
+				if len(match.Mismatches) > 0 {
+					printMismatches(report, match, matchText)
+				}
+				if caseBudget > 0 {
+					printCaseDeviations(report, match, matchText)
+				}
+				continue
+			}
+			if huntWords {
+				fmt.Fprintf(report, "Longest word: %s (%q at offset %d, %d letters)\n", match.Target, matchText, matchOffset(result, match), len(match.Target))
+				continue
+			}
+			if result.Partial {
+				fmt.Fprintf(report, "Closest match to %s: %q at offset %d\n", match.Target, matchText, matchOffset(result, match))
+				continue
+			}
+			if minScore > 0 {
+				fmt.Fprintf(report, "Matched target: %s (%q at offset %d, worth %d)\n", match.Target, matchText, matchOffset(result, match), weightOf(weights, slices.Index(targets, match.Target)))
+			} else if len(targetCases) > 0 || smartCase {
+				caseText := "case-sensitive"
+				if match.IgnoreCase {
+					caseText = "case-insensitive"
 				}
+				fmt.Fprintf(report, "Matched target: %s (%q at offset %d, %s)\n", match.Target, matchText, matchOffset(result, match), caseText)
+			} else if len(targets) > 1 || len(fingerprintTargets) > 0 || wordlist != "" {
+				fmt.Fprintf(report, "Matched target: %s (%q at offset %d)\n", match.Target, matchText, matchOffset(result, match))
+			} else if useRegex || confusables || maxMismatch > 0 || squashGaps > 0 || run != nil || palindrome != 0 || pronounceable != 0 || strings.ContainsAny(match.Target, "?*[\\") {
+				fmt.Fprintf(report, "Matched %q at offset %d\n", matchText, matchOffset(result, match))
+			}
+			if len(match.Mismatches) > 0 {
+				printMismatches(report, match, matchText)
+			}
+			if len(match.Positions) > 0 {
+				printSubsequence(report, result, match, matchText)
+			}
+			if caseBudget > 0 {
+				printCaseDeviations(report, match, matchText)
+			}
+			// Either anchor says which one held
+			if match.Mode == vanity.ModeSuffix {
+				fmt.Fprintf(report, "%s ends with: %s\n", strings.ToUpper(fieldName[:1])+fieldName[1:], matchText)
+			} else if mode == vanity.ModeEither {
+				fmt.Fprintf(report, "%s starts with: %s\n", strings.ToUpper(fieldName[:1])+fieldName[1:], matchText)
+			}
+		}
+
+		if positions {
+			for _, match := range result.Matches {
+				printPositions(report, result, match)
 			}
 		}
 
-		// Update global counter after processing the batch
-		atomic.AddUint64(totalAttempts, batchSize)
-		attempts = 0
+		if minScore > 0 {
+			fmt.Fprintf(report, "Score: %d (at least %d needed)\n", result.Score, minScore)
+		}
+
+		// How the search fared against the odds, for the first key found.
+		// It is a statistic, which --quiet drops, and only the JSON object
+		// carries it along with the result.
+		var luck *jsonLuck
+		if count == 1 && !result.Partial {
+			luck = searchLuck(opts, result.Attempts)
+		}
+		if luck != nil {
+			printLuck(info, luck, result.Attempts)
+		}
+
+		if jsonOut {
+			var embedded []byte
+			if toStdout {
+				embedded = privateKeyBytes
+			}
+			if err := writeJSON(os.Stdout, result, pubKeyLine, embedded, privatePath, path+".pub", time.Since(startTime), luck); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	fmt.Fprintf(info, "Total attempts across all workers: %d\n", results[0].TotalAttempts)
+	if len(excludes) > 0 {
+		fmt.Fprintf(info, "Matches rejected for an excluded sequence: %d\n", atomic.LoadUint64(&rejected))
+	}
+	if len(blocklist) > 0 {
+		fmt.Fprintf(info, "Matches rejected by the blocklist: %d\n", atomic.LoadUint64(&blocked))
+	}
+	if avoid != "" {
+		fmt.Fprintf(info, "Matches rejected for an avoided character: %d\n", atomic.LoadUint64(&avoided))
+	}
+	summarize(!results[0].Partial)
+	if exitStatus != 0 {
+		os.Exit(exitStatus)
 	}
 }
 
-// Fast case-sensitive byte slice contains check
-func containsBytes(haystack, needle []byte) bool {
-	if len(needle) == 0 {
-		return true
+// printPlan tells what a --dry-run would have gone on to do, on top of the
+// banner already printed
+func printPlan(w io.Writer, opts vanity.Options, keyFile, privateSuffix string, patternFiles map[string]string, count int, toStdout bool, authorizedPath string, timeout time.Duration) {
+	batch := opts.BatchSize
+	if batch == 0 {
+		batch = vanity.DefaultBatchSize
+		if opts.KeyType == vanity.KeyRSA {
+			batch = 1
+		}
 	}
-	if len(needle) > len(haystack) {
-		return false
+	fmt.Fprintf(w, "Batch size: %d\n", batch)
+	if timeout > 0 {
+		fmt.Fprintf(w, "Timeout: %s\n", timeout)
+	}
+	if opts.MaxAttempts > 0 {
+		fmt.Fprintf(w, "Attempt limit: %d\n", opts.MaxAttempts)
 	}
 
-	for i := 0; i <= len(haystack)-len(needle); i++ {
-		found := true
-		for j := 0; j < len(needle); j++ {
-			if haystack[i+j] != needle[j] {
-				found = false
-				break
+	switch {
+	case toStdout:
+		fmt.Fprintf(w, "Output: stdout\n")
+	case patternFiles != nil:
+		for _, target := range opts.Targets {
+			if path, ok := patternFiles[target]; ok {
+				fmt.Fprintf(w, "Output for %s: %s and %s.pub\n", target, path+privateSuffix, path)
 			}
 		}
-		if found {
-			return true
+	case count > 1:
+		for i := 1; i <= count; i++ {
+			path := numberedKeyFile(keyFile, i)
+			fmt.Fprintf(w, "Output: %s and %s.pub\n", path+privateSuffix, path)
+		}
+	default:
+		fmt.Fprintf(w, "Output: %s and %s.pub\n", keyFile+privateSuffix, keyFile)
+	}
+	if authorizedPath != "" {
+		fmt.Fprintf(w, "Appending to: %s\n", authorizedPath)
+	}
+	fmt.Fprintf(w, "Dry run: no key generated or written\n")
+}
+
+// numberedKeyFile names the n-th key of a --count search, such as id_ed25519_2
+func numberedKeyFile(keyFile string, n int) string {
+	return fmt.Sprintf("%s_%d", keyFile, n)
+}
+
+// patternKeyFiles names the key file for each of targets after keyFile and
+// the target, such as id_ed25519_yegor. Characters that are unsafe in a file
+// name become '_', and names that come out the same, even in another case for
+// case-insensitive file systems, are told apart by a number in target order.
+func patternKeyFiles(keyFile string, targets []string) map[string]string {
+	files := make(map[string]string, len(targets))
+	taken := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		if _, ok := files[target]; ok {
+			continue
+		}
+		name := keyFile + "_" + sanitizeFileName(target)
+		path := name
+		for n := 2; taken[strings.ToLower(path)]; n++ {
+			path = fmt.Sprintf("%s_%d", name, n)
 		}
+		taken[strings.ToLower(path)] = true
+		files[target] = path
 	}
-	return false
+	return files
 }
 
-// Fast case-insensitive byte slice contains check
-func containsBytesIgnoreCase(haystack, needle []byte) bool {
-	if len(needle) == 0 {
-		return true
+// sanitizeFileName keeps the letters, digits, '-' and '.' of s and replaces
+// everything else, '/' and wildcards included, with '_'
+func sanitizeFileName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '.' && i > 0:
+		default:
+			b[i] = '_'
+		}
 	}
-	if len(needle) > len(haystack) {
-		return false
+	return string(b)
+}
+
+// workerSummary lists the attempts of each worker along with the spread
+// between the busiest and the idlest
+func workerSummary(counts []uint64) string {
+	var b strings.Builder
+	b.WriteString("Worker attempts:")
+	lo, hi := uint64(math.MaxUint64), uint64(0)
+	for i := range counts {
+		n := atomic.LoadUint64(&counts[i])
+		lo, hi = min(lo, n), max(hi, n)
+		fmt.Fprintf(&b, " #%d %d", i, n)
 	}
+	fmt.Fprintf(&b, " | Min: %d | Max: %d", lo, hi)
+	return b.String()
+}
 
-	for i := 0; i <= len(haystack)-len(needle); i++ {
-		found := true
-		for j := 0; j < len(needle); j++ {
-			// Convert both bytes to lowercase for comparison
-			haystackChar := toLowerCase(haystack[i+j])
-			needleChar := needle[j] // Already converted to lowercase in worker
-			if haystackChar != needleChar {
-				found = false
-				break
-			}
+// parseInterspersed parses args with fs, allowing options after positional
+// arguments, which it returns in order. A "--" still ends the options.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		// Errors exit, as with flag.Parse
+		_ = fs.Parse(args)
+		rest := fs.Args()
+		if consumed := args[:len(args)-len(rest)]; len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// expandHome replaces a leading ~ in path with the home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot expand ~ in %s: %v", path, err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// existingFile returns the first of paths that already exists, or ""
+func existingFile(paths ...string) string {
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// marshalPrivateKey encodes key in the --format given, encrypted with
+// passphrase unless it is empty
+func marshalPrivateKey(key crypto.Signer, format, comment, passphrase string) ([]byte, error) {
+	switch format {
+	case "ppk":
+		return marshalPPK(key, comment, passphrase)
+	case "pkcs8":
+		// PKCS #8 has nowhere to keep the comment; the public key line
+		// still carries it
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+
+	var block *pem.Block
+	var err error
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, comment, []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(key, comment)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// publicKeyLine returns the authorized_keys line of result, with the comment
+// after a single space as OpenSSH writes it
+func publicKeyLine(result *vanity.Result, comment string) string {
+	line := strings.TrimSpace(result.AuthorizedKey)
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
+// keyModes holds the permissions key files are written with
+type keyModes struct {
+	private, public os.FileMode
+}
+
+// parseFileMode parses the octal permissions given to flag, such as "0640"
+func parseFileMode(flag, text string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(text, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("%s must be octal permissions such as 0600, got %q", flag, text)
+	}
+	return os.FileMode(mode), nil
+}
+
+// writeKeyFiles writes a key pair with the given permissions, creating the
+// directory of the private key when missing. Errors say which step failed.
+// Both files are written in full under temporary names before either is
+// renamed into place, so a process killed part way leaves no truncated key
+// and at most a moment where the private key has no public key beside it.
+func writeKeyFiles(privatePath, publicPath string, privateKey []byte, pubKeyLine string, modes keyModes) error {
+	if err := os.MkdirAll(filepath.Dir(privatePath), 0700); err != nil {
+		return fmt.Errorf("creating key directory: %v", err)
+	}
+	privateTemp, err := writeTemp(privatePath, privateKey, modes.private)
+	if err != nil {
+		return fmt.Errorf("writing private key: %v", err)
+	}
+	defer os.Remove(privateTemp)
+	publicTemp, err := writeTemp(publicPath, []byte(pubKeyLine+"\n"), modes.public)
+	if err != nil {
+		return fmt.Errorf("writing public key: %v", err)
+	}
+	defer os.Remove(publicTemp)
+
+	if err := os.Rename(privateTemp, privatePath); err != nil {
+		return fmt.Errorf("writing private key: %v", err)
+	}
+	if err := os.Rename(publicTemp, publicPath); err != nil {
+		return fmt.Errorf("writing public key: %v", err)
+	}
+	return nil
+}
+
+// writeTemp writes data with permissions perm to a new temporary file next to
+// path, ready to be renamed over it, and returns its name. Nothing is left
+// behind when it fails. A renamed file keeps perm, so an overwritten private
+// key cannot keep looser permissions.
+func writeTemp(path string, data []byte, perm os.FileMode) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+	if err := writeAndClose(f, data, perm); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// writeAndClose fills the new file f with data, applies perm and syncs it to
+// disk before closing it, so a rename cannot expose it half written
+func writeAndClose(f *os.File, data []byte, perm os.FileMode) error {
+	defer f.Close()
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// appendLine adds line to the end of the file at path, as authorized_keys
+// expects it, creating the file and its directory with private permissions
+// when missing. A file not ending in a newline gets one first so the line
+// does not run into the previous entry.
+func appendLine(path, line string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if size := info.Size(); size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, size-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			line = "\n" + line
+		}
+	}
+
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// stringList collects the values of a flag that may be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// searchedText returns the representation of result's key that field
+// searches, which the offsets of its matches refer to
+func searchedText(result *vanity.Result, field vanity.Field) string {
+	switch field {
+	case vanity.FieldFingerprint:
+		return result.Fingerprint
+	case vanity.FieldMD5Fingerprint:
+		return result.MD5Fingerprint
+	case vanity.FieldBubbleBabble:
+		return result.BubbleBabble
+	case vanity.FieldHex:
+		return result.PublicKeyHex
+	}
+	return result.AuthorizedKey
+}
+
+// parseRun parses a --run specification such as "z:7" or "any:7"
+func parseRun(spec string) (*vanity.Run, error) {
+	char, count, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("--run must look like char:count or any:count, got %q", spec)
+	}
+
+	length, err := strconv.Atoi(count)
+	if err != nil || length < 1 {
+		return nil, fmt.Errorf("--run count must be a positive number, got %q", count)
+	}
+
+	run := &vanity.Run{Length: length}
+	switch {
+	case char == "any":
+	case len(char) == 1:
+		run.Char = char[0]
+	default:
+		return nil, fmt.Errorf("--run character must be a single character or any, got %q", char)
+	}
+	return run, nil
+}
+
+// parseStartRange parses a --range specification such as "14:29" into the
+// offsets a match may start at, the end excluded
+func parseStartRange(spec string) (*vanity.Range, error) {
+	startText, endText, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("--range must look like start:end, got %q", spec)
+	}
+	start, err := strconv.Atoi(startText)
+	if err != nil || start < 0 {
+		return nil, fmt.Errorf("--range bounds must be non-negative numbers, got %q", startText)
+	}
+	end, err := strconv.Atoi(endText)
+	if err != nil || end < 0 {
+		return nil, fmt.Errorf("--range bounds must be non-negative numbers, got %q", endText)
+	}
+	if end <= start {
+		return nil, fmt.Errorf("--range %s is empty; give the start first and an end past it", spec)
+	}
+	return &vanity.Range{Start: start, End: end}, nil
+}
+
+// parseNumberRange expands a --number-range specification such as
+// "1990:1999" into every decimal number it covers, in order. Numbers have as
+// many digits as they need, so "99:101" gives 99, 100 and 101, unless the low
+// bound is written with leading zeros: "007:120" pads them all to three.
+func parseNumberRange(spec string) ([]string, error) {
+	lowText, highText, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("--number-range must look like low:high, got %q", spec)
+	}
+	low, err := strconv.ParseUint(lowText, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("--number-range bounds must be non-negative numbers, got %q", lowText)
+	}
+	high, err := strconv.ParseUint(highText, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("--number-range bounds must be non-negative numbers, got %q", highText)
+	}
+	if low > high {
+		return nil, fmt.Errorf("--number-range %s runs backwards; give the low bound first", spec)
+	}
+	if high-low >= maxRangeNumbers {
+		return nil, fmt.Errorf("--number-range %s covers more than %d numbers; narrow it", spec, maxRangeNumbers)
+	}
+
+	width := 0
+	if len(lowText) > 1 && lowText[0] == '0' {
+		width = len(lowText)
+	}
+	numbers := make([]string, 0, high-low+1)
+	for n := low; ; n++ {
+		numbers = append(numbers, fmt.Sprintf("%0*d", width, n))
+		if n == high {
+			break
 		}
-		if found {
-			return true
+	}
+	return numbers, nil
+}
+
+// printMismatches shows the target above the text that matched it, with a
+// caret under every character that differs
+func printMismatches(w io.Writer, match vanity.Match, matchText string) {
+	// MD5 offsets skip the colons
+	target := strings.ReplaceAll(match.Target, ":", "")
+	found := strings.ReplaceAll(matchText, ":", "")
+
+	markers := []byte(strings.Repeat(" ", len(target)))
+	for _, offset := range match.Mismatches {
+		markers[offset] = '^'
+	}
+	fmt.Fprintf(w, "%d of %d characters differ from the target:\n", len(match.Mismatches), len(target))
+	fmt.Fprintf(w, "  target: %s\n", target)
+	fmt.Fprintf(w, "  found:  %s\n", found)
+	fmt.Fprintf(w, "          %s\n", strings.TrimRight(string(markers), " "))
+}
+
+// printHighlight shows text with a caret under each character from start to
+// end
+func printHighlight(w io.Writer, text string, start, end int) {
+	fmt.Fprintf(w, "  %s\n", text)
+	fmt.Fprintf(w, "  %s%s\n", strings.Repeat(" ", start), strings.Repeat("^", end-start))
+}
+
+// printSubsequence shows where each character of a --subsequence match
+// lies, with a caret under each within the stretch of key it spans
+func printSubsequence(w io.Writer, result *vanity.Result, match vanity.Match, matchText string) {
+	base, _ := offsetBase(result, match.Field, match.Start)
+	var offsets []string
+	markers := []byte(strings.Repeat(" ", len(matchText)))
+	for _, p := range match.Positions {
+		offsets = append(offsets, strconv.Itoa(p-base))
+		markers[p-match.Start] = '^'
+	}
+	fmt.Fprintf(w, "Matched %s in order at offsets %s\n", match.Target, strings.Join(offsets, ", "))
+	fmt.Fprintf(w, "  %s\n", matchText)
+	fmt.Fprintf(w, "  %s\n", strings.TrimRight(string(markers), " "))
+}
+
+// printPositions lists the offsets of every occurrence of match, counted
+// as offsetBase counts them
+func printPositions(w io.Writer, result *vanity.Result, match vanity.Match) {
+	spans := match.Spans
+	if len(spans) == 0 {
+		spans = []vanity.Span{{Start: match.Start, End: match.End}}
+	}
+
+	base, where := offsetBase(result, match.Field, spans[0].Start)
+	var offsets []string
+	for _, span := range spans {
+		offsets = append(offsets, strconv.Itoa(span.Start-base))
+	}
+	plural := ""
+	if len(offsets) > 1 {
+		plural = "s"
+	}
+	fmt.Fprintf(w, "%s matched at offset%s %s in %s\n", match.Target, plural, strings.Join(offsets, ", "), where)
+}
+
+// offsetBase returns where in the text field searches the offsets printed
+// for a match starting at start are counted from, and what that is called.
+// Every offset shown counts from the start of the base64 key body or of the
+// digest, leaving out the key type and "SHA256:" around them; only a
+// --match-full-line match starting in the key type counts from the start of
+// the line.
+func offsetBase(result *vanity.Result, field vanity.Field, start int) (int, string) {
+	switch field {
+	case vanity.FieldKey:
+		if body := strings.IndexByte(result.AuthorizedKey, ' ') + 1; start >= body {
+			return body, "the base64 body"
+		}
+		return 0, "the authorized_keys line"
+	case vanity.FieldFingerprint:
+		return len("SHA256:"), "the fingerprint"
+	case vanity.FieldMD5Fingerprint:
+		return 0, "the MD5 fingerprint"
+	case vanity.FieldBubbleBabble:
+		return 0, "the Bubble Babble digest"
+	case vanity.FieldHex:
+		return 0, "the hex public key"
+	}
+	return 0, "the authorized_keys line"
+}
+
+// matchOffset returns the offset printed for match, counted as offsetBase
+// counts it
+func matchOffset(result *vanity.Result, match vanity.Match) int {
+	base, _ := offsetBase(result, match.Field, match.Start)
+	return match.Start - base
+}
+
+// printCaseDeviations shows which letters of a --ci-budget match differ in
+// case from the target as typed
+func printCaseDeviations(w io.Writer, match vanity.Match, matchText string) {
+	if len(match.CaseDeviations) == 0 {
+		fmt.Fprintf(w, "Every letter matches in the case typed\n")
+		return
+	}
+	markers := []byte(strings.Repeat(" ", len(match.Target)))
+	for _, offset := range match.CaseDeviations {
+		markers[offset] = '^'
+	}
+	fmt.Fprintf(w, "%d of %d characters differ in case from the target:\n", len(match.CaseDeviations), len(match.Target))
+	fmt.Fprintf(w, "  target: %s\n", match.Target)
+	fmt.Fprintf(w, "  found:  %s\n", matchText)
+	fmt.Fprintf(w, "          %s\n", strings.TrimRight(string(markers), " "))
+}
+
+// parseTargetSpec splits a --target value such as "ci:backup" into the
+// target and how its case is compared
+func parseTargetSpec(spec string) (string, vanity.Case) {
+	switch {
+	case strings.HasPrefix(spec, "ci:"):
+		return spec[len("ci:"):], vanity.CaseInsensitive
+	case strings.HasPrefix(spec, "cs:"):
+		return spec[len("cs:"):], vanity.CaseSensitive
+	}
+	return spec, vanity.CaseDefault
+}
+
+// parseScoreSpec splits a --score value such as "yegor=10" into the target
+// and its weight. The weight follows the last '=', which base64 targets never
+// contain anyway.
+func parseScoreSpec(spec string) (string, int, error) {
+	i := strings.LastIndexByte(spec, '=')
+	if i < 0 {
+		return "", 0, fmt.Errorf("--score must look like seq=weight, got %q", spec)
+	}
+	weight, err := strconv.Atoi(spec[i+1:])
+	if err != nil || weight < 1 {
+		return "", 0, fmt.Errorf("--score weight must be a positive number, got %q", spec[i+1:])
+	}
+	return spec[:i], weight, nil
+}
+
+// weightOf returns the weight of the i-th target, which is one past the end
+// of weights
+func weightOf(weights []int, i int) int {
+	if i >= 0 && i < len(weights) {
+		return weights[i]
+	}
+	return 1
+}
+
+// parseArtCell parses a --randomart specification such as "0:8:^"
+func parseArtCell(spec string) (vanity.ArtCell, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 || len(parts[2]) != 1 {
+		return vanity.ArtCell{}, fmt.Errorf("--randomart must look like row:col:char, got %q", spec)
+	}
+	row, rowErr := strconv.Atoi(parts[0])
+	col, colErr := strconv.Atoi(parts[1])
+	if rowErr != nil || colErr != nil {
+		return vanity.ArtCell{}, fmt.Errorf("--randomart row and column must be numbers, got %q", spec)
+	}
+	return vanity.ArtCell{Row: row, Col: col, Char: parts[2][0]}, nil
+}
+
+// parseCharsetRegion parses a --charset-region specification such as
+// "-8:8:digits"
+func parseCharsetRegion(spec string) (vanity.CharsetRegion, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 {
+		return vanity.CharsetRegion{}, fmt.Errorf("--charset-region must look like start:len:class, got %q", spec)
+	}
+	start, startErr := strconv.Atoi(parts[0])
+	length, lengthErr := strconv.Atoi(parts[1])
+	if startErr != nil || lengthErr != nil {
+		return vanity.CharsetRegion{}, fmt.Errorf("--charset-region start and length must be numbers, got %q", spec)
+	}
+
+	var class vanity.Charset
+	switch parts[2] {
+	case "digits":
+		class = vanity.CharsetDigits
+	case "lower":
+		class = vanity.CharsetLower
+	case "upper":
+		class = vanity.CharsetUpper
+	case "alpha":
+		class = vanity.CharsetAlpha
+	default:
+		return vanity.CharsetRegion{}, fmt.Errorf("--charset-region class must be digits, lower, upper or alpha, got %q", parts[2])
+	}
+	return vanity.CharsetRegion{Start: start, Length: length, Class: class}, nil
+}
+
+// skipImpossible drops the targets of opts from index first on, which came
+// from file, that could never match on their own, warning about each. Should
+// none be left the targets are kept as they are for Validate to report.
+func skipImpossible(opts vanity.Options, first int, file string) []string {
+	kept := opts.Targets[:first:first]
+	var warnings []string
+	for _, target := range opts.Targets[first:] {
+		probe := opts
+		probe.Targets = []string{target}
+		probe.TargetCases, probe.Weights, probe.MinScore = nil, nil, 0
+		if err := probe.Validate(); err != nil {
+			warnings = append(warnings, fmt.Sprintf("Warning: skipping %q from %s: %v\n", target, file, err))
+			continue
 		}
+		kept = append(kept, target)
+	}
+	if len(kept) == first {
+		return opts.Targets
 	}
-	return false
+	for _, warning := range warnings {
+		fmt.Fprint(os.Stderr, warning)
+	}
+	return kept
 }
 
-// Fast ASCII lowercase conversion
-func toLowerCase(b byte) byte {
-	if b >= 'A' && b <= 'Z' {
-		return b + ('a' - 'A')
+// readWordlist loads newline-separated targets from path, skipping blank lines
+// and lines starting with '#'
+func readWordlist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words = append(words, word)
 	}
-	return b
+	return words, scanner.Err()
 }
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+
+	"ssh-keygen/vanity"
+)
+
+// testKey is a freshly generated key of one of the supported types
+type testKey struct {
+	name string
+	key  crypto.Signer
+}
+
+// generateTestKeys returns an ed25519, an RSA and an ECDSA key
+func generateTestKeys(t *testing.T) []testKey {
+	t.Helper()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []testKey{{"ed25519", edKey}, {"rsa", rsaKey}, {"ecdsa", ecKey}}
+}
+
+func TestMarshalPKCS8RoundTrip(t *testing.T) {
+	for _, tc := range generateTestKeys(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := marshalPrivateKey(tc.key, "pkcs8", "comment", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			block, rest := pem.Decode(out)
+			if block == nil {
+				t.Fatalf("no PEM block in %q", out)
+			}
+			if len(rest) > 0 {
+				t.Errorf("trailing data after the PEM block: %q", rest)
+			}
+			if block.Type != "PRIVATE KEY" {
+				t.Errorf("PEM type = %q, want PRIVATE KEY", block.Type)
+			}
+
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, ok := tc.key.(interface{ Equal(crypto.PrivateKey) bool })
+			if !ok || !want.Equal(parsed) {
+				t.Errorf("parsed key %T differs from the generated key", parsed)
+			}
+		})
+	}
+}
+
+// parsePPK reads the header fields of a version 3 PPK file, with the
+// Public-Lines and Private-Lines blocks decoded under "Public" and "Private"
+func parsePPK(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	fields := map[string]string{}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		name, value, ok := strings.Cut(lines[i], ": ")
+		if !ok {
+			t.Fatalf("line %d is not a header: %q", i+1, lines[i])
+		}
+		if _, dup := fields[name]; dup {
+			t.Fatalf("header %s appears twice", name)
+		}
+		fields[name] = value
+
+		block, ok := strings.CutSuffix(name, "-Lines")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || i+n >= len(lines) {
+			t.Fatalf("bad %s: %q", name, value)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(lines[i+1:i+1+n], ""))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		fields[block] = string(decoded)
+		i += n
+	}
+	return fields
+}
+
+// readSSHString splits the first length-prefixed SSH string off data
+func readSSHString(t *testing.T, data []byte) ([]byte, []byte) {
+	t.Helper()
+	if len(data) < 4 || len(data)-4 < int(binary.BigEndian.Uint32(data)) {
+		t.Fatalf("truncated SSH string in %x", data)
+	}
+	n := 4 + int(binary.BigEndian.Uint32(data))
+	return data[4:n], data[n:]
+}
+
+func TestMarshalPPK(t *testing.T) {
+	for _, tc := range generateTestKeys(t) {
+		for _, passphrase := range []string{"", "correct horse"} {
+			t.Run(fmt.Sprintf("%s/passphrase=%q", tc.name, passphrase), func(t *testing.T) {
+				out, err := marshalPrivateKey(tc.key, "ppk", "a comment", passphrase)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fields := parsePPK(t, out)
+
+				sshPub, err := ssh.NewPublicKey(tc.key.Public())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := fields["PuTTY-User-Key-File-3"]; got != sshPub.Type() {
+					t.Errorf("algorithm = %q, want %q", got, sshPub.Type())
+				}
+				if got := fields["Comment"]; got != "a comment" {
+					t.Errorf("comment = %q, want %q", got, "a comment")
+				}
+				if fields["Public"] != string(sshPub.Marshal()) {
+					t.Errorf("public blob differs from the key's wire format")
+				}
+
+				// Re-derive the keys from the header the way PuTTY does
+				private := []byte(fields["Private"])
+				var macKey []byte
+				switch fields["Encryption"] {
+				case "none":
+					if passphrase != "" {
+						t.Fatalf("encryption = none with a passphrase")
+					}
+				case "aes256-cbc":
+					if passphrase == "" {
+						t.Fatalf("encryption = aes256-cbc without a passphrase")
+					}
+					if fields["Key-Derivation"] != "Argon2id" {
+						t.Fatalf("key derivation = %q, want Argon2id", fields["Key-Derivation"])
+					}
+					memory, err1 := strconv.ParseUint(fields["Argon2-Memory"], 10, 32)
+					passes, err2 := strconv.ParseUint(fields["Argon2-Passes"], 10, 32)
+					parallelism, err3 := strconv.ParseUint(fields["Argon2-Parallelism"], 10, 8)
+					salt, err4 := hex.DecodeString(fields["Argon2-Salt"])
+					if err := errors.Join(err1, err2, err3, err4); err != nil {
+						t.Fatalf("bad Argon2 parameters: %v", err)
+					}
+					derived := argon2.IDKey([]byte(passphrase), salt, uint32(passes), uint32(memory), uint8(parallelism), 80)
+					if len(private)%aes.BlockSize != 0 {
+						t.Fatalf("private blob of %d bytes is not whole blocks", len(private))
+					}
+					block, err := aes.NewCipher(derived[:32])
+					if err != nil {
+						t.Fatal(err)
+					}
+					cipher.NewCBCDecrypter(block, derived[32:48]).CryptBlocks(private, private)
+					macKey = derived[48:]
+				default:
+					t.Fatalf("encryption = %q", fields["Encryption"])
+				}
+
+				var macData []byte
+				for _, field := range []string{fields["PuTTY-User-Key-File-3"], fields["Encryption"], fields["Comment"], fields["Public"], string(private)} {
+					macData = binary.BigEndian.AppendUint32(macData, uint32(len(field)))
+					macData = append(macData, field...)
+				}
+				h := hmac.New(sha256.New, macKey)
+				h.Write(macData)
+				if got, want := fields["Private-MAC"], hex.EncodeToString(h.Sum(nil)); got != want {
+					t.Errorf("MAC = %s, want %s", got, want)
+				}
+
+				// The first private field is the secret itself
+				secret, _ := readSSHString(t, private)
+				var want []byte
+				switch k := tc.key.(type) {
+				case ed25519.PrivateKey:
+					want = k.Seed()
+				case *rsa.PrivateKey:
+					want = k.D.Bytes()
+				case *ecdsa.PrivateKey:
+					want = k.D.Bytes()
+				}
+				if new(big.Int).SetBytes(secret).Cmp(new(big.Int).SetBytes(want)) != 0 {
+					t.Errorf("private blob starts with %x, want %x", secret, want)
+				}
+			})
+		}
+	}
+}
+
+func TestParseArtCell(t *testing.T) {
+	cell, err := parseArtCell("5:5:^")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (vanity.ArtCell{Row: 5, Col: 5, Char: '^'}); cell != want {
+		t.Errorf("parseArtCell = %v, want %v", cell, want)
+	}
+	for _, spec := range []string{"5:5", "5:5:ab", "x:5:^"} {
+		if _, err := parseArtCell(spec); err == nil {
+			t.Errorf("parseArtCell(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestSmartCaseTargetOverride(t *testing.T) {
+	target, targetCase := parseTargetSpec("cs:abc")
+	if target != "abc" || targetCase != vanity.CaseSensitive {
+		t.Fatalf("parseTargetSpec(%q) = %q, %v", "cs:abc", target, targetCase)
+	}
+	opts := vanity.Options{SmartCase: true, Targets: []string{target}, TargetCases: []vanity.Case{targetCase}}
+	if opts.IgnoresCase(0) {
+		t.Errorf("--target cs:abc with --smart-case ignores case")
+	}
+}
+
+func TestSmartCaseCheaperAlternative(t *testing.T) {
+	opts := vanity.Options{SmartCase: true, Targets: []string{"yEgor"}}
+	expected, _ := opts.ExpectedAttempts()
+	for _, alt := range cheaperAlternatives(opts) {
+		if !alt.opts.CaseInsensitive {
+			continue
+		}
+		if err := alt.opts.Validate(); err != nil {
+			t.Fatalf("%s alternative is invalid: %v", alt.label, err)
+		}
+		if altExpected, ok := alt.opts.ExpectedAttempts(); !ok || altExpected >= expected {
+			t.Errorf("%s alternative expects %v attempts, want fewer than %v", alt.label, altExpected, expected)
+		}
+		return
+	}
+	t.Errorf("no case-insensitive alternative under --smart-case")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// stdinReader is shared by every prompt so a passphrase piped in along with
+// its confirmation is not lost to buffering
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// promptPassphrase asks for a new passphrase twice, as ssh-keygen does. An
+// empty answer leaves the private key unencrypted.
+func promptPassphrase() (string, error) {
+	passphrase, err := readPassphrase("Enter passphrase (empty for no passphrase): ")
+	if err != nil {
+		return "", err
+	}
+	confirmation, err := readPassphrase("Enter same passphrase again: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirmation {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// readPassphrase prints prompt on stderr and reads a line from stdin, with
+// echo turned off when stdin is a terminal
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	if stdinIsTerminal() {
+		passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+		// The newline typed by the user was not echoed either
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("reading passphrase: %v", err)
+		}
+		return string(passphrase), nil
+	}
+
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading passphrase: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// stdinIsTerminal reports whether stdin is a terminal someone can type at
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// Argon2id parameters for passphrase-protected PPK files. PuTTYgen tunes the
+// passes to take about a tenth of a second; a fixed count keeps the output
+// independent of the machine while costing about as much.
+const (
+	ppkArgon2Memory      = 8192 // KiB
+	ppkArgon2Passes      = 21
+	ppkArgon2Parallelism = 1
+	ppkSaltLen           = 16
+)
+
+// marshalPPK encodes key as a PuTTY version 3 private key file, encrypted
+// with aes256-cbc under a key Argon2id derives from passphrase when one is
+// given. The public half is the SSH wire blob, the private half the fields
+// PuTTY adds to it, and an HMAC-SHA-256 over both and the header guards
+// against tampering.
+func marshalPPK(key crypto.Signer, comment, passphrase string) ([]byte, error) {
+	sshPub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	private, err := ppkPrivateBlob(key)
+	if err != nil {
+		return nil, err
+	}
+	public := sshPub.Marshal()
+	algorithm := sshPub.Type()
+
+	encryption := "none"
+	var cipherKey, iv, macKey []byte
+	var kdf bytes.Buffer
+	if passphrase != "" {
+		encryption = "aes256-cbc"
+
+		// The cipher works in whole blocks; PuTTY pads with random bytes
+		if extra := len(private) % aes.BlockSize; extra != 0 {
+			padding := make([]byte, aes.BlockSize-extra)
+			if _, err := rand.Read(padding); err != nil {
+				return nil, err
+			}
+			private = append(private, padding...)
+		}
+
+		salt := make([]byte, ppkSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		// One derivation yields the cipher key, the IV and the MAC key
+		derived := argon2.IDKey([]byte(passphrase), salt, ppkArgon2Passes, ppkArgon2Memory, ppkArgon2Parallelism, 32+aes.BlockSize+32)
+		cipherKey, iv, macKey = derived[:32], derived[32:32+aes.BlockSize], derived[32+aes.BlockSize:]
+
+		fmt.Fprintf(&kdf, "Key-Derivation: Argon2id\n")
+		fmt.Fprintf(&kdf, "Argon2-Memory: %d\n", ppkArgon2Memory)
+		fmt.Fprintf(&kdf, "Argon2-Passes: %d\n", ppkArgon2Passes)
+		fmt.Fprintf(&kdf, "Argon2-Parallelism: %d\n", ppkArgon2Parallelism)
+		fmt.Fprintf(&kdf, "Argon2-Salt: %x\n", salt)
+	}
+
+	// The MAC covers the padded plaintext, under an empty key when there is
+	// no passphrase
+	mac := ppkMAC(macKey, algorithm, encryption, comment, public, private)
+	if cipherKey != nil {
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, err
+		}
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(private, private)
+	}
+	return formatPPK(algorithm, encryption, comment, public, kdf.Bytes(), private, mac), nil
+}
+
+// ppkPrivateBlob returns the private fields PuTTY stores for key, each in
+// SSH wire format
+func ppkPrivateBlob(key crypto.Signer) ([]byte, error) {
+	var blob []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		// The 32-byte seed, which PuTTY reads as a little-endian integer
+		blob = appendSSHBytes(blob, k.Seed())
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, fmt.Errorf("PuTTY only stores RSA keys with two primes")
+		}
+		blob = appendMPInt(blob, k.D)
+		blob = appendMPInt(blob, k.Primes[0])
+		blob = appendMPInt(blob, k.Primes[1])
+		blob = appendMPInt(blob, k.Precomputed.Qinv) // q^-1 mod p
+	case *ecdsa.PrivateKey:
+		blob = appendMPInt(blob, k.D)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return blob, nil
+}
+
+// ppkMAC returns the hex HMAC-SHA-256 a version 3 file ends with
+func ppkMAC(macKey []byte, algorithm, encryption, comment string, public, private []byte) string {
+	var data []byte
+	data = appendSSHBytes(data, []byte(algorithm))
+	data = appendSSHBytes(data, []byte(encryption))
+	data = appendSSHBytes(data, []byte(comment))
+	data = appendSSHBytes(data, public)
+	data = appendSSHBytes(data, private)
+
+	h := hmac.New(sha256.New, macKey)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// formatPPK lays out the text of a version 3 file. Key derivation lines, if
+// any, go between the public and the private lines.
+func formatPPK(algorithm, encryption, comment string, public, kdf, private []byte, mac string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "PuTTY-User-Key-File-3: %s\n", algorithm)
+	fmt.Fprintf(&b, "Encryption: %s\n", encryption)
+	fmt.Fprintf(&b, "Comment: %s\n", comment)
+	writePPKLines(&b, "Public-Lines", public)
+	b.Write(kdf)
+	writePPKLines(&b, "Private-Lines", private)
+	fmt.Fprintf(&b, "Private-MAC: %s\n", mac)
+	return b.Bytes()
+}
+
+// writePPKLines writes data as base64 wrapped at 64 characters, after a
+// header giving the number of lines
+func writePPKLines(b *bytes.Buffer, header string, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	lines := (len(encoded) + 63) / 64
+	fmt.Fprintf(b, "%s: %d\n", header, lines)
+	for i := 0; i < len(encoded); i += 64 {
+		fmt.Fprintf(b, "%s\n", encoded[i:min(i+64, len(encoded))])
+	}
+}
+
+// appendSSHBytes appends s as a length-prefixed SSH string
+func appendSSHBytes(dst, s []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(s)))
+	return append(dst, s...)
+}
+
+// appendMPInt appends a non-negative n as an SSH mpint, with a leading zero
+// byte when its top bit is set so it does not read as negative
+func appendMPInt(dst []byte, n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return appendSSHBytes(dst, b)
+}
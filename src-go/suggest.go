@@ -0,0 +1,184 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"ssh-keygen/vanity"
+)
+
+// maxSuggestions caps how many alternatives the suggest subcommand lists
+const maxSuggestions = 10
+
+// leetDigits maps letters to the digits often written in their place
+var leetDigits = map[byte]byte{
+	'a': '4', 'b': '8', 'e': '3', 'g': '9', 'i': '1',
+	'l': '1', 'o': '0', 's': '5', 't': '7', 'z': '2',
+}
+
+// suggestion is a cheaper variant of a target and how far it strays from it
+type suggestion struct {
+	target  string
+	ci      bool
+	dropped int // characters trimmed off the target
+	relaxed int // of --ci and leet digits, how many were added
+	seconds float64
+}
+
+// printSuggestions measures the key rate for opts, whose single literal
+// target is target, and lists variants of it that are found sooner, each as
+// a complete command line. Those expected within threshold come first,
+// closest to the target first: fewest characters dropped, then fewest
+// relaxations.
+func printSuggestions(opts vanity.Options, target string, threshold time.Duration) error {
+	fmt.Printf("Measuring the key rate for %s...\n", calibrationTime)
+	rate, err := vanity.MeasureRate(context.Background(), opts, calibrationTime)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rate: ~%.0f keys/s\n", rate)
+
+	expected, ok := opts.ExpectedAttempts()
+	if !ok {
+		return fmt.Errorf("no estimate is possible for this search, so nothing can be suggested")
+	}
+	fmt.Printf("Expected time for %s: %s\n", target, formatSeconds(expected/rate))
+
+	var found []suggestion
+	for dropped := 0; dropped < len(target); dropped++ {
+		base := target[:len(target)-dropped]
+		if opts.Mode == vanity.ModeSuffix {
+			base = target[dropped:]
+		}
+		for _, ci := range []bool{opts.CaseInsensitive, true} {
+			for _, leet := range []bool{false, true} {
+				s := suggestion{target: base, ci: ci, dropped: dropped}
+				if ci != opts.CaseInsensitive {
+					s.relaxed++
+				}
+				if leet {
+					if s.target = leetClasses(base); s.target == base {
+						continue
+					}
+					s.relaxed++
+				}
+				if s.dropped == 0 && s.relaxed == 0 || slices.ContainsFunc(found, func(f suggestion) bool { return f.target == s.target && f.ci == s.ci }) {
+					continue
+				}
+
+				alt := opts
+				alt.Targets = []string{s.target}
+				alt.CaseInsensitive = ci
+				alt.SmartCase = opts.SmartCase && !ci
+				altExpected, ok := alt.ExpectedAttempts()
+				if !ok || altExpected >= expected {
+					continue
+				}
+				s.seconds = altExpected / rate
+				found = append(found, s)
+			}
+		}
+	}
+	if len(found) == 0 {
+		fmt.Println("No cheaper variant of the target found")
+		return nil
+	}
+
+	slices.SortStableFunc(found, func(a, b suggestion) int {
+		aFar, bFar := a.seconds > threshold.Seconds(), b.seconds > threshold.Seconds()
+		switch {
+		case aFar != bFar:
+			if aFar {
+				return 1
+			}
+			return -1
+		case a.dropped != b.dropped:
+			return a.dropped - b.dropped
+		case a.relaxed != b.relaxed:
+			return a.relaxed - b.relaxed
+		}
+		return cmp.Compare(a.seconds, b.seconds)
+	})
+
+	fmt.Println("Suggestions, closest to the target first:")
+	flags := commandFlags()
+	for _, s := range found[:min(len(found), maxSuggestions)] {
+		args := slices.Clone(flags)
+		if s.ci {
+			// --ci ignores case for every target, which --smart-case refuses
+			args = slices.DeleteFunc(args, func(arg string) bool { return arg == "--smart-case" })
+			args = append(args, "--ci")
+		}
+		args = append(args, shellQuote(s.target))
+		fmt.Printf("  %-18s %s %s\n", formatSeconds(s.seconds), shellQuote(os.Args[0]), strings.Join(args, " "))
+	}
+	return nil
+}
+
+// leetClasses lets every letter of target with a common leet digit match
+// either, as in y[e3]g[o0]r
+func leetClasses(target string) string {
+	var b strings.Builder
+	for i := 0; i < len(target); i++ {
+		c := target[i]
+		if digit, ok := leetDigits[c|0x20]; ok && isLetter(c) {
+			fmt.Fprintf(&b, "[%c%c]", c, digit)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// isLetter reports whether c is an ASCII letter
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// commandFlags rebuilds the options given on the command line, leaving out
+// --ci, which each suggestion sets for itself
+func commandFlags() []string {
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "ci" {
+			return
+		}
+		if list, ok := f.Value.(*stringList); ok {
+			for _, value := range *list {
+				args = append(args, shellQuote("--"+f.Name+"="+value))
+			}
+			return
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			if f.Value.String() == "true" {
+				args = append(args, "--"+f.Name)
+			}
+			return
+		}
+		args = append(args, shellQuote("--"+f.Name+"="+f.Value.String()))
+	})
+	return args
+}
+
+// shellQuote quotes s for a POSIX shell when it holds anything but plain
+// word characters
+func shellQuote(s string) string {
+	safe := s != ""
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isLetter(c) && !(c >= '0' && c <= '9') && !strings.ContainsRune("-_=./:,+@%", rune(c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,133 @@
+package vanity
+
+// automaton is an Aho-Corasick matcher compiled down to a dense transition
+// table, so a haystack is scanned once no matter how many targets there are.
+// Only bytes that occur in some target get their own column; every other
+// byte shares column zero and always leads back towards the root.
+type automaton struct {
+	classes  [256]uint16 // byte -> column in next
+	width    int         // number of columns per state
+	next     []int32     // state*width + class -> next state
+	out      []int32     // state -> index of a target ending here, or -1
+	depths   []int32     // state -> length of the trie path leading to it
+	lengths  []int       // target index -> target length
+	foldCase bool        // lowercase haystack bytes before the transition
+}
+
+// newAutomaton builds an automaton for targets. With foldCase set the
+// targets must already be lowercase.
+func newAutomaton(targets [][]byte, foldCase bool) *automaton {
+	a := &automaton{foldCase: foldCase, width: 1}
+
+	for _, target := range targets {
+		for _, b := range target {
+			if a.classes[b] == 0 {
+				a.classes[b] = uint16(a.width)
+				a.width++
+			}
+		}
+		a.lengths = append(a.lengths, len(target))
+	}
+
+	// Build the trie; zero in next means "no edge" until links are resolved
+	a.next = make([]int32, a.width)
+	a.out = []int32{-1}
+	a.depths = []int32{0}
+	for i, target := range targets {
+		state := int32(0)
+		for _, b := range target {
+			edge := int(state)*a.width + int(a.classes[b])
+			if a.next[edge] == 0 {
+				a.next[edge] = int32(len(a.out))
+				a.next = append(a.next, make([]int32, a.width)...)
+				a.out = append(a.out, -1)
+				a.depths = append(a.depths, a.depths[state]+1)
+			}
+			state = a.next[edge]
+		}
+		if a.out[state] < 0 {
+			a.out[state] = int32(i)
+		}
+	}
+
+	// Resolve failure links breadth-first, turning the trie into a DFA
+	fail := make([]int32, len(a.out))
+	queue := make([]int32, 0, len(a.out))
+	for c := 0; c < a.width; c++ {
+		if child := a.next[c]; child != 0 {
+			queue = append(queue, child)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		if a.out[state] < 0 {
+			a.out[state] = a.out[fail[state]]
+		}
+
+		for c := 0; c < a.width; c++ {
+			edge := int(state)*a.width + c
+			fallback := a.next[int(fail[state])*a.width+c]
+			if child := a.next[edge]; child != 0 {
+				fail[child] = fallback
+				queue = append(queue, child)
+			} else {
+				a.next[edge] = fallback
+			}
+		}
+	}
+
+	return a
+}
+
+// find returns the index and start offset of the first target to end in
+// haystack, or -1 if none occurs
+func (a *automaton) find(haystack []byte) (int, int) {
+	state := int32(0)
+	for i, b := range haystack {
+		if a.foldCase {
+			b = toLowerCase(b)
+		}
+		state = a.next[int(state)*a.width+int(a.classes[b])]
+		if target := a.out[state]; target >= 0 {
+			return int(target), i + 1 - a.lengths[target]
+		}
+	}
+	return -1, -1
+}
+
+// anchored returns the index of a target haystack starts with, or -1 if
+// none does. With backwards set haystack is read from its end, which finds a
+// target it ends with when the automaton was built from reversed targets.
+func (a *automaton) anchored(haystack []byte, backwards bool) int {
+	state := int32(0)
+	for n := 1; n <= len(haystack); n++ {
+		b := haystack[n-1]
+		if backwards {
+			b = haystack[len(haystack)-n]
+		}
+		if a.foldCase {
+			b = toLowerCase(b)
+		}
+		state = a.next[int(state)*a.width+int(a.classes[b])]
+
+		// Following a failure link leaves the anchor behind for good
+		if a.depths[state] != int32(n) {
+			return -1
+		}
+		if target := a.out[state]; target >= 0 && a.lengths[target] == n {
+			return int(target)
+		}
+	}
+	return -1
+}
+
+// alias gives every byte the column of its representative in t, so the
+// automaton matches up to equivalence without any per-byte work in find. The
+// targets must already be canonical.
+func (a *automaton) alias(t *equivalenceTable) {
+	for b := range a.classes {
+		a.classes[b] = a.classes[t[b]]
+	}
+}
@@ -0,0 +1,70 @@
+package vanity
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// pastedRunes names characters that chat apps and word processors slip into
+// copied text, mapped to the ASCII they stand in for, if any
+var pastedRunes = map[rune]struct {
+	name  string
+	ascii string
+}{
+	'\u00a0': {"no-break space", ""},
+	'\u200b': {"zero-width space", ""},
+	'\u200c': {"zero-width non-joiner", ""},
+	'\u200d': {"zero-width joiner", ""},
+	'\u2060': {"word joiner", ""},
+	'\ufeff': {"byte order mark", ""},
+	'\u2018': {"left single quotation mark", ""},
+	'\u2019': {"right single quotation mark", ""},
+	'\u201c': {"left double quotation mark", ""},
+	'\u201d': {"right double quotation mark", ""},
+	'\u2010': {"hyphen", "-"},
+	'\u2011': {"non-breaking hyphen", "-"},
+	'\u2013': {"en dash", "-"},
+	'\u2014': {"em dash", "-"},
+	'\u2212': {"minus sign", "-"},
+	'\u2044': {"fraction slash", "/"},
+	'\u2215': {"division slash", "/"},
+}
+
+// validateASCII reports the characters of a target that are not ASCII and so
+// can never appear in a key, fingerprint or digest. It runs before anything
+// folds case or parses the target byte by byte, which would quietly mangle
+// multi-byte characters.
+func validateASCII(kind, target string) error {
+	var found []string
+	var cleaned strings.Builder
+	for offset, r := range target {
+		if r < utf8.RuneSelf {
+			cleaned.WriteRune(r)
+			continue
+		}
+
+		desc := fmt.Sprintf("%U", r)
+		if r == utf8.RuneError {
+			desc = "invalid UTF-8"
+		}
+		if pasted, ok := pastedRunes[r]; ok {
+			desc += " (" + pasted.name + ")"
+			cleaned.WriteString(pasted.ascii)
+		} else if r >= '\uff01' && r <= '\uff5e' {
+			// Fullwidth forms mirror ASCII at a fixed distance
+			desc += " (fullwidth " + string(r-0xfee0) + ")"
+			cleaned.WriteRune(r - 0xfee0)
+		}
+		found = append(found, fmt.Sprintf("%s at byte %d", desc, offset))
+	}
+	if found == nil {
+		return nil
+	}
+
+	err := fmt.Sprintf("%s %q contains characters that are not ASCII and can never match: %s", kind, target, strings.Join(found, ", "))
+	if suggestion := cleaned.String(); suggestion != "" {
+		err += fmt.Sprintf("; did you mean %q?", suggestion)
+	}
+	return fmt.Errorf("%s", err)
+}
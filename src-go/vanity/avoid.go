@@ -0,0 +1,89 @@
+package vanity
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// newAvoidSet validates Options.Avoid and returns its characters as a set,
+// or nil when there are none. Only the variable part of the key body is
+// checked, since the fixed header is the same for every key of a type and
+// may well hold an avoided character itself.
+func newAvoidSet(opts Options, layout *keyLayout) (*byteSet, error) {
+	if opts.Avoid == "" {
+		return nil, nil
+	}
+	set := new(byteSet)
+	for i := 0; i < len(opts.Avoid); i++ {
+		c := opts.Avoid[i]
+		if strings.IndexByte(base64Alphabet, c) < 0 {
+			return nil, fmt.Errorf("avoided character %q never appears in a key body; only A-Z, a-z, 0-9, + and / do", c)
+		}
+		set[c] = true
+	}
+	if strings.Trim(layout.firstChars, opts.Avoid) == "" {
+		return nil, fmt.Errorf("every character that can start the key body after its header (%s) is avoided", layout.firstChars)
+	}
+	if strings.Trim(layout.lastChars, opts.Avoid) == "" {
+		return nil, fmt.Errorf("every character that can end the key body (%s) is avoided", layout.lastChars)
+	}
+
+	// A literal key target holding an avoided character could never be
+	// accepted
+	if opts.Field == FieldKey && !opts.Regex && !opts.Confusables {
+		for i, target := range opts.Targets {
+			if hasPatterns(target) || opts.IgnoresCase(i) {
+				continue
+			}
+			if i := strings.IndexAny(unescape(target), opts.Avoid); i >= 0 {
+				return nil, fmt.Errorf("target sequence %q contains the avoided character %q", target, unescape(target)[i])
+			}
+		}
+	}
+	return set, nil
+}
+
+// hasAvoided reports whether the variable part of the body of the key with
+// the given wire blob holds an Options.Avoid character. Like isBlocked it
+// reuses the worker's line scratch space.
+func (m *matcher) hasAvoided(blob []byte, line *[]byte) bool {
+	*line = appendAuthorizedKey((*line)[:0], m.layout.typePrefix, blob)
+	for _, c := range m.layout.body(*line)[len(m.layout.header):] {
+		if m.avoid[c] {
+			return true
+		}
+	}
+	return false
+}
+
+// avoidProbability estimates the chance that no character of the variable
+// part of the key body is in Options.Avoid, leaving out the covered
+// characters a match already accounts for
+func avoidProbability(opts Options, layout *keyLayout, covered int) float64 {
+	if opts.Avoid == "" {
+		return 1
+	}
+	avoided := func(c byte) bool { return strings.IndexByte(opts.Avoid, c) >= 0 }
+
+	// The first and last characters have fewer possible values
+	p := (1 - setProbability(layout.firstChars, avoided)) * (1 - setProbability(layout.lastChars, avoided))
+	if rest := layout.variableLen() - 2 - covered; rest > 0 {
+		p *= math.Pow(1-fieldProbability(FieldKey, avoided), float64(rest))
+	}
+	return p
+}
+
+// coveredLen returns how many characters of the variable part of the key
+// body any match of the targets covers at least
+func coveredLen(opts Options) int {
+	if opts.Field != FieldKey || opts.Regex || len(opts.Targets) == 0 {
+		return 0
+	}
+	covered := math.MaxInt
+	for _, target := range opts.Targets {
+		atoms, _ := parseTarget(target)
+		covered = min(covered, minTargetLen(atoms))
+	}
+	return covered
+}
@@ -0,0 +1,60 @@
+package vanity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// benchmarkTarget can never appear in a base64 key, so a benchmark scans
+// every key without ever stopping at one. Validation would refuse it, so it
+// takes the place of an ordinary target once the matcher is built.
+const benchmarkTarget = "-"
+
+// Benchmark generates keys of the type opts describe for duration on every
+// worker, marshalling each one and scanning it for a target that can never
+// match, and returns how many keys a second it got through. Only the key
+// type, Workers, BatchSize, Seed, Attempts and WorkerAttempts of opts are
+// used, so the rate measures the machine rather than a search. When ctx is
+// cancelled early the rate so far is returned along with ctx.Err().
+func Benchmark(ctx context.Context, opts Options, duration time.Duration) (float64, error) {
+	if duration <= 0 {
+		return 0, fmt.Errorf("a benchmark needs a positive duration")
+	}
+
+	bench := Options{
+		KeyType:        opts.KeyType,
+		Bits:           opts.Bits,
+		Curve:          opts.Curve,
+		Targets:        []string{"A"},
+		Workers:        opts.Workers,
+		BatchSize:      opts.BatchSize,
+		Seed:           opts.Seed,
+		Attempts:       opts.Attempts,
+		WorkerAttempts: opts.WorkerAttempts,
+	}
+	if bench.Attempts == nil {
+		bench.Attempts = new(uint64)
+	}
+	m, err := newMatcher(bench)
+	if err != nil {
+		return 0, err
+	}
+	m.targets[0] = []byte(benchmarkTarget)
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	start := time.Now()
+	err = runWorkers(ctx, bench, []*matcher{m}, nil, false, func(Result) bool { return true })
+	rate := float64(atomic.LoadUint64(bench.Attempts)) / time.Since(start).Seconds()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return rate, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("benchmark target matched a key")
+	}
+	return rate, err
+}
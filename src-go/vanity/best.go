@@ -0,0 +1,172 @@
+package vanity
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// BestEffort tracks the key that came closest to matching during a
+// best-effort search. Its methods are safe to call while the search runs.
+type BestEffort struct {
+	score  atomic.Uint64 // packed partialScore of result, zero until anything matched
+	mu     sync.Mutex
+	result *Result
+}
+
+// Result returns the closest key found so far, or nil when not even the first
+// character of the target has turned up yet
+func (b *BestEffort) Result() *Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.result == nil {
+		return nil
+	}
+	r := *b.result
+	return &r
+}
+
+// offer records r unless a key scoring at least as well is already kept
+func (b *BestEffort) offer(score uint64, r Result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if score <= b.score.Load() {
+		return
+	}
+	b.result = &r
+	b.score.Store(score)
+}
+
+// partial scores how close a region comes to holding the single literal
+// target of a best-effort search. Only the start of the target counts, or its
+// end for ModeSuffix, so a better key always extends the previous best.
+type partial struct {
+	target []byte // canonical through fold, except exact characters
+	exact  []bool // set for characters escaped to match exactly
+	raw    []byte // as given, to count characters matching in exact case
+	fold   *equivalenceTable
+	mode   Mode
+	at     int
+}
+
+// newPartial compiles target, which has already been validated and stripped
+// of any MD5 colons, comparing characters through fold
+func newPartial(target string, mode Mode, at int, fold *equivalenceTable) *partial {
+	p := &partial{fold: fold, mode: mode, at: at}
+	for i := 0; i < len(target); i++ {
+		exact := target[i] == caseEscape
+		if exact {
+			i++
+		}
+		c := target[i]
+		p.raw = append(p.raw, c)
+		p.exact = append(p.exact, exact)
+		if exact {
+			p.target = append(p.target, c)
+		} else {
+			p.target = append(p.target, fold[c])
+		}
+	}
+	return p
+}
+
+// validateBest reports why opts cannot run a best-effort search
+func validateBest(opts Options) error {
+	switch {
+	case opts.Regex:
+		return fmt.Errorf("a best-effort search cannot score regular expressions")
+	case opts.Run != nil:
+		return fmt.Errorf("a best-effort search needs a target sequence, not a run")
+	case opts.Palindrome > 0:
+		return fmt.Errorf("a best-effort search needs a target sequence, not a palindrome")
+	case opts.Pronounceable > 0:
+		return fmt.Errorf("a best-effort search needs a target sequence, not a pronounceable ending")
+	case len(opts.Targets) != 1:
+		return fmt.Errorf("a best-effort search needs exactly one target sequence")
+	case hasPatterns(opts.Targets[0]):
+		return fmt.Errorf("a best-effort search cannot score targets with wildcards or character classes")
+	case opts.MinCount > 1:
+		return fmt.Errorf("a best-effort search cannot score repeated occurrences")
+	case len(opts.Randomart) > 0:
+		return fmt.Errorf("a best-effort search cannot score randomart")
+	case len(opts.Charsets) > 0:
+		return fmt.Errorf("a best-effort search cannot score character class regions")
+	case len(opts.FingerprintTargets) > 0 || opts.FingerprintRegex != "":
+		return fmt.Errorf("a best-effort search cannot score fingerprint targets")
+	case opts.MinScore > 0:
+		return fmt.Errorf("a best-effort search cannot be combined with a minimum score")
+	case opts.Delimited:
+		return fmt.Errorf("a best-effort search cannot score delimited matches")
+	}
+	return nil
+}
+
+// score rates region by the longest part of the target it holds where the
+// mode allows, then by how many of those characters match in exact case, and
+// finally by how close to the end of the region they lie. The result packs
+// all three so that a larger value is always better and zero means nothing
+// matched, and comes with the offsets of the matched part.
+func (p *partial) score(region []byte) (uint64, int, int) {
+	best, bestStart, bestEnd := uint64(0), 0, 0
+	consider := func(start, end, exact int) {
+		if end == start {
+			return
+		}
+		score := uint64(end-start)<<32 | uint64(exact)<<16 | uint64(start)
+		if score > best {
+			best, bestStart, bestEnd = score, start, end
+		}
+	}
+
+	if p.mode == ModeSuffix {
+		n, exact := 0, 0
+		for n < len(p.target) && n < len(region) {
+			j, c := len(p.target)-1-n, region[len(region)-1-n]
+			if !p.matches(j, c) {
+				break
+			}
+			if c == p.raw[j] {
+				exact++
+			}
+			n++
+		}
+		consider(len(region)-n, len(region), exact)
+		return best, bestStart, bestEnd
+	}
+
+	first, last := 0, len(region)-1
+	if p.mode == ModePrefix || p.mode == ModeAt {
+		first, last = p.at, p.at
+	}
+	for i := first; i <= last && i < len(region); i++ {
+		n, exact := 0, 0
+		for n < len(p.target) && i+n < len(region) && p.matches(n, region[i+n]) {
+			if region[i+n] == p.raw[n] {
+				exact++
+			}
+			n++
+		}
+		consider(i, i+n, exact)
+	}
+	return best, bestStart, bestEnd
+}
+
+// matches reports whether c matches the j-th character of the target
+func (p *partial) matches(j int, c byte) bool {
+	if p.exact[j] {
+		return c == p.target[j]
+	}
+	return p.fold[c] == p.target[j]
+}
+
+// nearMiss scores region for a best-effort search, by the longest word for
+// Options.Words and through the partial target otherwise, and returns the
+// offsets of the part that scored along with what it stands for
+func (m *matcher) nearMiss(region []byte) (uint64, int, int, string) {
+	if m.words != nil {
+		word, start, end := m.words.longest(region)
+		return uint64(len(word)), start, end, word
+	}
+	score, start, end := m.partial.score(region)
+	return score, start, end, m.patterns[0]
+}
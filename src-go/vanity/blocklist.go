@@ -0,0 +1,73 @@
+package vanity
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+//go:embed blocklist.txt
+var defaultBlocklist string
+
+// DefaultBlocklist returns the built-in list of profanities and slurs, for
+// use as Options.Blocklist
+func DefaultBlocklist() []string {
+	var words []string
+	for _, line := range strings.Split(defaultBlocklist, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words
+}
+
+// blocklist rejects keys whose base64 body or SHA256 fingerprint holds any of
+// its words, ignoring case. A single automaton scans both, so a long list
+// costs no more than a short one.
+type blocklist struct {
+	automaton *automaton
+}
+
+// newBlocklist compiles the Blocklist of opts, or returns nil when it is
+// empty. Words a literal target holds are left out, since the search asked
+// for them.
+func newBlocklist(opts Options) (*blocklist, error) {
+	var words [][]byte
+	for _, word := range opts.Blocklist {
+		if err := validateASCII("blocklisted sequence", word); err != nil {
+			return nil, err
+		}
+		if word == "" {
+			return nil, fmt.Errorf("blocklisted sequence cannot be empty")
+		}
+		lowered := lowerASCII(word)
+		if !opts.Regex && (targetsHold(opts.Targets, lowered) || targetsHold(opts.FingerprintTargets, lowered)) {
+			continue
+		}
+		words = append(words, lowered)
+	}
+	if len(words) == 0 {
+		return nil, nil
+	}
+	return &blocklist{automaton: newAutomaton(words, true)}, nil
+}
+
+// targetsHold reports whether any of targets holds word, ignoring case
+func targetsHold(targets []string, word []byte) bool {
+	for _, target := range targets {
+		if indexBytesIgnoreCase([]byte(unescape(target)), word) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// blocked reports whether a base64 key body or fingerprint digest, without
+// the key type or "SHA256:" in front, shows a blocklisted word
+func (b *blocklist) blocked(body, digest []byte) bool {
+	if i, _ := b.automaton.find(body); i >= 0 {
+		return true
+	}
+	i, _ := b.automaton.find(digest)
+	return i >= 0
+}
@@ -0,0 +1,165 @@
+package vanity
+
+import "fmt"
+
+// Bubble Babble encodes a digest as pronounceable five-letter groups, as shown
+// by ssh-keygen -B. x/crypto/ssh has no encoder, so this follows the reference
+// in OpenSSH's sshkey.c byte for byte.
+const (
+	bubbleVowels     = "aeiouy"
+	bubbleConsonants = "bcdfghklmnprstvzx"
+)
+
+// bubbleBabbleLen is the encoded length of a SHA1 digest, which is what
+// ssh-keygen -B encodes: an 'x' at each end, ten full six-character rounds
+// and a final three-character round.
+const bubbleBabbleLen = 2 + 10*6 + 3
+
+// bubbleBabbleAlphabet lists every character an encoding can contain
+const bubbleBabbleAlphabet = bubbleVowels + bubbleConsonants + "-"
+
+// bubbleBabbleChars returns the characters that can appear at offset i of an
+// encoded SHA1 digest. Each full round is vowel, consonant, vowel, consonant,
+// dash, consonant, drawing on every consonant but 'x'; the final round is
+// vowel, 'x', vowel, and an 'x' closes the digest as one opens it. The seed
+// of the first round is fixed, which leaves its vowels four choices each.
+func bubbleBabbleChars(i int) string {
+	switch {
+	case i == 0 || i == bubbleBabbleLen-3 || i == bubbleBabbleLen-1:
+		return "x"
+	case i == 1:
+		return bubbleVowels[1:5]
+	case i == 3:
+		return bubbleVowels[:4]
+	case i >= bubbleBabbleLen-4:
+		return bubbleVowels
+	}
+	switch (i - 1) % 6 {
+	case 0, 2:
+		return bubbleVowels
+	case 4:
+		return "-"
+	}
+	return bubbleConsonants[:len(bubbleConsonants)-1]
+}
+
+// bubbleBabbleOffsets returns the first and last offset at which opts may
+// start a match of n characters in a Bubble Babble digest. There are none
+// when first is past last.
+func bubbleBabbleOffsets(n int, opts Options) (first, last int) {
+	last = bubbleBabbleLen - n
+	switch opts.Mode {
+	case ModePrefix:
+		return 0, 0
+	case ModeAt:
+		return opts.At, opts.At
+	case ModeSuffix:
+		return last, last
+	}
+	if opts.Last > 0 {
+		first = bubbleBabbleLen - opts.Last
+	}
+	if opts.Range != nil {
+		first, last = opts.Range.Start, min(last, opts.Range.End-1)
+	}
+	return max(first, 0), last
+}
+
+// bubbleBabbleFits reports whether atoms, none of them a run, can lie at
+// offset in a Bubble Babble digest with at most mismatches of them out of
+// place. Possible reports whether an atom stands for any character of a set.
+func bubbleBabbleFits(atoms []atom, offset, mismatches int, possible func(set string, a atom) bool) bool {
+	for i, a := range atoms {
+		if a.kind != atomAny && !possible(bubbleBabbleChars(offset+i), a) {
+			mismatches--
+			if mismatches < 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateBubbleBabble reports why atoms can never lie where opts look for
+// them in a Bubble Babble digest. Each stretch between runs must fit the
+// pattern of vowels, consonants and dashes at some offset it can reach.
+func validateBubbleBabble(target string, atoms []atom, opts Options, possible func(set string, a atom) bool) error {
+	var segments [][]atom
+	start := 0
+	for i := 0; i <= len(atoms); i++ {
+		if i == len(atoms) || atoms[i].kind == atomRun {
+			if i > start {
+				segments = append(segments, atoms[start:i])
+			}
+			start = i + 1
+		}
+	}
+
+	anchoredFirst := opts.Mode == ModePrefix || opts.Mode == ModeAt
+	anchoredLast := opts.Mode == ModeSuffix
+	if anchoredFirst && atoms[0].kind == atomRun {
+		anchoredFirst = false
+	}
+	if anchoredLast && atoms[len(atoms)-1].kind == atomRun {
+		anchoredLast = false
+	}
+
+	first := atoms[0]
+	if opts.Mode == ModePrefix && anchoredFirst && first.kind != atomAny && !possible("x", first) && opts.MaxMismatch == 0 {
+		return fmt.Errorf("a Bubble Babble digest always starts with 'x', so a prefix must begin with it, not %s", first.quote())
+	}
+	last := atoms[len(atoms)-1]
+	if anchoredLast && last.kind != atomAny && !possible("x", last) && opts.MaxMismatch == 0 {
+		return fmt.Errorf("a Bubble Babble digest always ends with 'x', so a suffix must end with it, not %s", last.quote())
+	}
+
+	for i, segment := range segments {
+		lo, hi := bubbleBabbleOffsets(len(segment), Options{Last: opts.Last, Range: opts.Range})
+		switch {
+		case i == 0 && anchoredFirst:
+			lo, hi = bubbleBabbleOffsets(len(segment), opts)
+		case i == len(segments)-1 && anchoredLast:
+			lo, hi = bubbleBabbleOffsets(len(segment), opts)
+		}
+		fits := false
+		for offset := lo; offset <= hi && !fits; offset++ {
+			fits = bubbleBabbleFits(segment, offset, opts.MaxMismatch, possible)
+		}
+		if !fits {
+			return fmt.Errorf("target sequence %q can never match: each round of a Bubble Babble digest is vowel, consonant, vowel, consonant, '-', consonant between an 'x' at each end, and it fits nowhere it may start", target)
+		}
+	}
+	return nil
+}
+
+// appendBubbleBabble appends the Bubble Babble encoding of digest to dst
+func appendBubbleBabble(dst, digest []byte) []byte {
+	rounds := len(digest)/2 + 1
+	seed := 1
+
+	dst = append(dst, 'x')
+	for i := 0; i < rounds; i++ {
+		if i+1 < rounds || len(digest)%2 != 0 {
+			b0 := int(digest[2*i])
+			dst = append(dst,
+				bubbleVowels[((b0>>6)&3+seed)%6],
+				bubbleConsonants[(b0>>2)&15],
+				bubbleVowels[((b0&3)+seed/6)%6])
+
+			if i+1 < rounds {
+				b1 := int(digest[2*i+1])
+				dst = append(dst,
+					bubbleConsonants[(b1>>4)&15],
+					'-',
+					bubbleConsonants[b1&15])
+				seed = (seed*5 + b0*7 + b1) % 36
+			}
+		} else {
+			dst = append(dst,
+				bubbleVowels[seed%6],
+				bubbleConsonants[16],
+				bubbleVowels[seed/6])
+		}
+	}
+	return append(dst, 'x')
+}
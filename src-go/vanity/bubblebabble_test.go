@@ -0,0 +1,123 @@
+package vanity
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// goldenKey is a fixed ed25519 public key; the golden strings the tests
+// compare against are what OpenSSH 9.2 prints for it
+const goldenKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAILMSyLLqEFAP6Fr/yBzgabDXOH+qb/H52ztAgbocXBxI"
+
+// parseGoldenKey parses goldenKey
+func parseGoldenKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(goldenKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestBubbleBabbleGolden(t *testing.T) {
+	// ssh-keygen -B -f golden.pub
+	const want = "xebok-hopyk-razym-gutep-vegiv-tizes-lafip-kadel-lytob-gotub-nyxax"
+	got := bubbleBabble(parseGoldenKey(t))
+	if got != want {
+		t.Errorf("bubbleBabble = %q, want %q", got, want)
+	}
+	if len(got) != bubbleBabbleLen {
+		t.Errorf("len(bubbleBabble) = %d, want bubbleBabbleLen = %d", len(got), bubbleBabbleLen)
+	}
+}
+
+// digests returns n distinct SHA1 digests to encode
+func digests(n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		sum := sha1.Sum(binary.BigEndian.AppendUint64(nil, uint64(i)))
+		out[i] = sum[:]
+	}
+	return out
+}
+
+func TestBubbleBabbleChars(t *testing.T) {
+	seen := make([]map[byte]bool, bubbleBabbleLen)
+	for i := range seen {
+		seen[i] = map[byte]bool{}
+	}
+	for _, digest := range digests(4000) {
+		for i, c := range appendBubbleBabble(nil, digest) {
+			if strings.IndexByte(bubbleBabbleChars(i), c) < 0 {
+				t.Fatalf("offset %d holds %q, which bubbleBabbleChars(%d) = %q leaves out", i, c, i, bubbleBabbleChars(i))
+			}
+			seen[i][c] = true
+		}
+	}
+	for i := range seen {
+		if len(seen[i]) != len(bubbleBabbleChars(i)) {
+			t.Errorf("offset %d held %d distinct characters, bubbleBabbleChars(%d) = %q", i, len(seen[i]), i, bubbleBabbleChars(i))
+		}
+	}
+}
+
+func TestBubbleBabbleTargets(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		mode   Mode
+		ok     bool
+	}{
+		{"zuk", ModeAnywhere, true},
+		{"ab-c", ModeAnywhere, true},
+		{"aa", ModeAnywhere, false},
+		{"ka-b", ModeAnywhere, false},
+		{"xe", ModePrefix, true},
+		{"x*ab", ModePrefix, true},
+		{"ab", ModePrefix, false},
+		{"xa", ModePrefix, false},
+		{"ux", ModeSuffix, true},
+		{"ab", ModeSuffix, false},
+	} {
+		_, err := newMatcher(Options{Field: FieldBubbleBabble, Mode: tc.mode, Targets: []string{tc.target}})
+		if (err == nil) != tc.ok {
+			t.Errorf("mode %v: newMatcher(%q) error = %v, want ok = %v", tc.mode, tc.target, err, tc.ok)
+		}
+	}
+}
+
+func TestBubbleBabbleProbability(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		mode   Mode
+		want   float64
+	}{
+		{"x", ModePrefix, 1},
+		{"xe", ModePrefix, 1.0 / 4},
+		{"xeb", ModePrefix, 1.0 / 4 / 16},
+		{"ux", ModeSuffix, 1.0 / 6},
+		{"-", ModeAnywhere, 1},
+	} {
+		p, ok := Options{Field: FieldBubbleBabble, Mode: tc.mode, Targets: []string{tc.target}}.Probability()
+		if !ok || math.Abs(p-tc.want) > 1e-9 {
+			t.Errorf("mode %v: Probability(%q) = %v, %v, want %v", tc.mode, tc.target, p, ok, tc.want)
+		}
+	}
+
+	// Anywhere in the digest, the estimate should hold up against real ones
+	const target, n = "zuk", 20000
+	p, _ := Options{Field: FieldBubbleBabble, Targets: []string{target}}.Probability()
+	found := 0
+	for _, digest := range digests(n) {
+		if strings.Contains(string(appendBubbleBabble(nil, digest)), target) {
+			found++
+		}
+	}
+	if got := float64(found) / n; math.Abs(got-p) > p/4 {
+		t.Errorf("%q appeared in %.4f of digests, estimated %.4f", target, got, p)
+	}
+}
@@ -0,0 +1,81 @@
+package vanity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateCaseBudget reports why opts cannot limit the characters matched in
+// another case. The budget is counted position by position, so only plain
+// literal targets in a field with both cases qualify.
+func validateCaseBudget(opts Options) error {
+	switch {
+	case opts.CaseBudget < 0:
+		return fmt.Errorf("the number of characters allowed in another case cannot be negative")
+	case opts.Regex:
+		return fmt.Errorf("a case budget cannot be applied to regular expressions")
+	case len(opts.Targets) == 0:
+		return fmt.Errorf("a case budget only applies to target sequences")
+	case len(opts.TargetCases) > 0 || opts.SmartCase:
+		return fmt.Errorf("a case budget already decides how every target compares case")
+	case opts.Confusables:
+		return fmt.Errorf("a case budget cannot tell look-alike characters from changes in case")
+	case opts.MinCount > 1:
+		return fmt.Errorf("occurrences of a target with a case budget cannot be counted")
+	case opts.Best != nil:
+		return fmt.Errorf("a best-effort search cannot score targets with a case budget")
+	case opts.Field == FieldMD5Fingerprint || opts.Field == FieldBubbleBabble || opts.Field == FieldHex:
+		return fmt.Errorf("a case budget needs a field with both upper and lower case letters")
+	}
+
+	for _, target := range opts.Targets {
+		if hasPatterns(target) || hasCaseEscapes(target) {
+			return fmt.Errorf("target sequence %q uses wildcards, character classes or case escapes, which cannot be combined with a case budget", target)
+		}
+		if strings.ToLower(target) == strings.ToUpper(target) {
+			return fmt.Errorf("target sequence %q has no letters for a case budget to apply to", target)
+		}
+	}
+	return nil
+}
+
+// budgetProbability returns the chance that at most k of a window's
+// positions fail to match and at most budget more match only in another
+// case, when position j matches ignoring case with chance probs[j] and in
+// exact case with chance exact[j]
+func budgetProbability(probs, exact []float64, k, budget int) float64 {
+	// within[m][d] is the chance of exactly m mismatches and d characters in
+	// another case so far
+	grid := func() [][]float64 {
+		g := make([][]float64, k+1)
+		for m := range g {
+			g[m] = make([]float64, budget+1)
+		}
+		return g
+	}
+	within := grid()
+	within[0][0] = 1
+	for j, p := range probs {
+		next := grid()
+		for m := range within {
+			for d, q := range within[m] {
+				next[m][d] += q * exact[j]
+				if d < budget {
+					next[m][d+1] += q * (p - exact[j])
+				}
+				if m < k {
+					next[m+1][d] += q * (1 - p)
+				}
+			}
+		}
+		within = next
+	}
+
+	total := 0.0
+	for _, row := range within {
+		for _, q := range row {
+			total += q
+		}
+	}
+	return total
+}
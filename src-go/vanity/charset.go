@@ -0,0 +1,207 @@
+package vanity
+
+import "fmt"
+
+// Charset names a class of characters a CharsetRegion is restricted to
+type Charset int
+
+const (
+	CharsetDigits Charset = iota // 0-9
+	CharsetLower                 // a-z
+	CharsetUpper                 // A-Z
+	CharsetAlpha                 // A-Z and a-z
+)
+
+// String returns the name of the class
+func (c Charset) String() string {
+	switch c {
+	case CharsetDigits:
+		return "digits"
+	case CharsetLower:
+		return "lower"
+	case CharsetUpper:
+		return "upper"
+	case CharsetAlpha:
+		return "alpha"
+	}
+	return fmt.Sprintf("Charset(%d)", int(c))
+}
+
+// contains reports whether the class holds c. Case is never folded, since a
+// class of lowercase letters is about how the key reads.
+func (c Charset) contains(b byte) bool {
+	switch c {
+	case CharsetDigits:
+		return b >= '0' && b <= '9'
+	case CharsetLower:
+		return b >= 'a' && b <= 'z'
+	case CharsetUpper:
+		return b >= 'A' && b <= 'Z'
+	case CharsetAlpha:
+		return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+	}
+	return false
+}
+
+// CharsetRegion requires Length characters of a key, starting Start
+// characters after the fixed base64 header as Options.At counts them, to all
+// belong to Class. A negative Start counts back from the end of the key body,
+// so -8 covers its last eight characters. With the fingerprint fields the
+// region lies within the fingerprint or digest instead.
+type CharsetRegion struct {
+	Start  int
+	Length int
+	Class  Charset
+}
+
+// String describes the region for display
+func (r CharsetRegion) String() string {
+	nouns := map[Charset]string{
+		CharsetDigits: "digits",
+		CharsetLower:  "lowercase letters",
+		CharsetUpper:  "uppercase letters",
+		CharsetAlpha:  "letters",
+	}
+	switch {
+	case r.Start >= 0:
+		return fmt.Sprintf("only %s in the %d characters from position %d", nouns[r.Class], r.Length, r.Start)
+	case r.Start == -1 && r.Length == 1:
+		return fmt.Sprintf("only %s in the last character", nouns[r.Class])
+	case r.Start+r.Length == 0:
+		return fmt.Sprintf("only %s in the last %d characters", nouns[r.Class], r.Length)
+	}
+	return fmt.Sprintf("only %s in the %d characters from %d before the end", nouns[r.Class], r.Length, -r.Start)
+}
+
+// bounds returns the offsets the region covers within a region of regionLen
+// characters, which may lie outside it
+func (r CharsetRegion) bounds(regionLen int) (int, int) {
+	start := r.Start
+	if start < 0 {
+		start += regionLen
+	}
+	return start, start + r.Length
+}
+
+// validateCharsetRegion reports why r can never be satisfied under opts: it
+// must lie within the region anchored targets refer to, and every position
+// must be able to hold a character of the class
+func validateCharsetRegion(r CharsetRegion, opts Options, layout *keyLayout) error {
+	if r.Class < CharsetDigits || r.Class > CharsetAlpha {
+		return fmt.Errorf("unknown character class %v", r.Class)
+	}
+	if r.Length < 1 {
+		return fmt.Errorf("a character class region must be at least one character long")
+	}
+
+	regionLen, regionName := anchoredRegion(opts.Field, layout)
+	start, end := r.bounds(regionLen)
+	if start < 0 || end > regionLen {
+		return fmt.Errorf("character class region %d:%d runs past the %d-character %s", r.Start, r.Length, regionLen, regionName)
+	}
+
+	for i := start; i < end; i++ {
+		set := positionAlphabet(opts.Field, layout, i, regionLen)
+		if setProbability(set, r.Class.contains) == 0 {
+			return fmt.Errorf("position %d of the %s can never hold %s; only %s can appear there", i, regionName, r.Class, set)
+		}
+	}
+	return nil
+}
+
+// positionAlphabet returns the characters that can appear at offset i of the
+// region anchored targets refer to, which is regionLen characters long
+func positionAlphabet(field Field, layout *keyLayout, i, regionLen int) string {
+	switch {
+	case field == FieldKey && i == 0:
+		return layout.firstChars
+	case field == FieldKey && i == regionLen-1:
+		return layout.lastChars
+	case field == FieldFingerprint && i == regionLen-1:
+		return lastFingerprintChars
+	case field == FieldMD5Fingerprint || field == FieldHex:
+		return hexAlphabet
+	case field == FieldBubbleBabble:
+		return bubbleBabbleAlphabet
+	}
+	return base64Alphabet
+}
+
+// charsetSpan is a compiled CharsetRegion
+type charsetSpan struct {
+	start, end int
+	set        byteSet
+}
+
+// compileCharsets resolves the regions of opts, which must already be valid,
+// against the anchored region
+func compileCharsets(regions []CharsetRegion, field Field, layout *keyLayout) []charsetSpan {
+	regionLen, _ := anchoredRegion(field, layout)
+	var spans []charsetSpan
+	for _, r := range regions {
+		span := charsetSpan{}
+		span.start, span.end = r.bounds(regionLen)
+		for c := range span.set {
+			span.set[c] = r.Class.contains(byte(c))
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// inCharsets reports whether every character class region of subject holds
+// only characters of its class
+func (m *matcher) inCharsets(subject []byte) bool {
+	region, _ := m.scopeRegion(subject, ScopeVariable)
+	for i := range m.charsets {
+		span := &m.charsets[i]
+		for _, c := range region[span.start:span.end] {
+			if !span.set[c] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// charsetProbability estimates the chance that a single key satisfies every
+// region of opts. Overlapping regions are combined position by position, so
+// each position only needs a character belonging to all its classes.
+func charsetProbability(opts Options, layout *keyLayout) float64 {
+	regionLen, _ := anchoredRegion(opts.Field, layout)
+	classes := make([][]Charset, regionLen)
+	for _, r := range opts.Charsets {
+		start, end := r.bounds(regionLen)
+		for i := start; i < end; i++ {
+			classes[i] = append(classes[i], r.Class)
+		}
+	}
+
+	p := 1.0
+	for i, required := range classes {
+		if required == nil {
+			continue
+		}
+		accept := func(c byte) bool {
+			for _, class := range required {
+				if !class.contains(c) {
+					return false
+				}
+			}
+			return true
+		}
+		p *= positionProbability(opts.Field, layout, i, regionLen, accept)
+	}
+	return p
+}
+
+// positionProbability returns how often offset i of the region anchored
+// targets refer to holds a character that accept accepts
+func positionProbability(field Field, layout *keyLayout, i, regionLen int, accept func(c byte) bool) float64 {
+	set := positionAlphabet(field, layout, i, regionLen)
+	if set == bubbleBabbleAlphabet {
+		// Keep the weighting of vowels and consonants in each round
+		return fieldProbability(field, accept)
+	}
+	return setProbability(set, accept)
+}
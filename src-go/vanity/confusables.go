@@ -0,0 +1,106 @@
+package vanity
+
+// confusableGroups lists characters that are easily mistaken for one another
+// when reading a key, so Options.Confusables lets any of them stand in for the
+// others.
+var confusableGroups = []string{
+	"0Oo",
+	"1lI",
+	"2Z",
+	"5S",
+	"8B",
+}
+
+// equivalenceTable maps every byte to a canonical representative of the
+// bytes it should compare equal to
+type equivalenceTable [256]byte
+
+// newEquivalenceTable joins the confusable groups, and ASCII case when
+// foldCase is set, into one table. Groups are merged transitively, so with
+// foldCase "1", "l", "L", "I" and "i" all compare equal.
+func newEquivalenceTable(foldCase bool) *equivalenceTable {
+	var t equivalenceTable
+	for i := range t {
+		t[i] = byte(i)
+	}
+
+	// Always point at the smallest member so the union is order independent
+	var find func(b byte) byte
+	find = func(b byte) byte {
+		if t[b] != b {
+			t[b] = find(t[b])
+		}
+		return t[b]
+	}
+	union := func(a, b byte) {
+		a, b = find(a), find(b)
+		if a > b {
+			a, b = b, a
+		}
+		t[b] = a
+	}
+
+	for _, group := range confusableGroups {
+		for i := 1; i < len(group); i++ {
+			union(group[0], group[i])
+		}
+	}
+	if foldCase {
+		for c := byte('a'); c <= 'z'; c++ {
+			union(c, toUpperCase(c))
+		}
+	}
+
+	for i := range t {
+		t[i] = find(byte(i))
+	}
+	return &t
+}
+
+// canonical rewrites s with every byte replaced by its representative
+func (t *equivalenceTable) canonical(s string) []byte {
+	out := make([]byte, len(s))
+	for i := 0; i < len(s); i++ {
+		out[i] = t[s[i]]
+	}
+	return out
+}
+
+// contains reports whether set holds any byte equivalent to c
+func (t *equivalenceTable) contains(set string, c byte) bool {
+	for i := 0; i < len(set); i++ {
+		if t[set[i]] == t[c] {
+			return true
+		}
+	}
+	return false
+}
+
+// index returns the first offset in haystack where needle occurs up to
+// equivalence, or -1. The needle must already be canonical.
+func (t *equivalenceTable) index(haystack, needle []byte) int {
+	if len(needle) > len(haystack) {
+		return -1
+	}
+
+	for i := 0; i <= len(haystack)-len(needle); i++ {
+		if t.equal(haystack[i:i+len(needle)], needle) {
+			return i
+		}
+	}
+	return -1
+}
+
+// equal reports whether a equals b up to equivalence; b must already be
+// canonical
+func (t *equivalenceTable) equal(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if t[a[i]] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package vanity
+
+import "fmt"
+
+// Delimited matches need the characters on either side to differ in class
+// from the matched characters next to them, so that "9Dave7" or "xDAVEx"
+// stands out where "xdavex" would not. Digits, '+', '/' and anything else
+// that is not a letter form a class of their own.
+const (
+	classOther = iota
+	classLower
+	classUpper
+)
+
+// charClass returns the class of c for delimited matches
+func charClass(c byte) int {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return classLower
+	case c >= 'A' && c <= 'Z':
+		return classUpper
+	}
+	return classOther
+}
+
+// delimited reports whether region[start:end] is set off from its
+// neighbours. The edges of the region count as boundaries.
+func delimited(region []byte, start, end int) bool {
+	return (start == 0 || charClass(region[start-1]) != charClass(region[start])) &&
+		(end == len(region) || charClass(region[end]) != charClass(region[end-1]))
+}
+
+// validateDelimited reports why opts cannot require delimited matches. Only
+// literal targets can be found again at every position they occur.
+func validateDelimited(opts Options) error {
+	switch {
+	case opts.Regex:
+		return fmt.Errorf("delimited matches cannot be required of regular expressions; spell out the neighbours in the pattern instead")
+	case opts.Run != nil || opts.Palindrome != 0 || opts.Pronounceable != 0 || len(opts.Targets) == 0:
+		return fmt.Errorf("delimited matches can only be required of target sequences")
+	case opts.MaxMismatch > 0:
+		return fmt.Errorf("delimited matches cannot allow mismatched characters")
+	case opts.CaseBudget > 0:
+		return fmt.Errorf("delimited matches cannot be combined with a case budget")
+	case opts.MinCount > 1:
+		return fmt.Errorf("occurrences of delimited targets cannot be counted")
+	}
+	return nil
+}
+
+// findDelimited returns the offsets in region of the first delimited
+// occurrence of the i-th target, with lowered as for matchTarget
+func (m *matcher) findDelimited(region, lowered []byte, i int) (int, int, bool) {
+	// An anchored target has a single place to be
+	if m.mode != ModeAnywhere {
+		if !m.matchUndelimited(region, lowered, i) {
+			return 0, 0, false
+		}
+		var start, end int
+		switch {
+		case m.globs != nil && m.globs[i] != nil:
+			start, end, _ = m.globs[i].find(region, m.mode, m.at)
+		case m.mode == ModeSuffix:
+			start, end = len(region)-len(m.targets[i]), len(region)
+		default:
+			start, end = m.at, m.at+len(m.targets[i])
+		}
+		return start, end, delimited(region, start, end)
+	}
+
+	// Otherwise every occurrence gets its turn
+	for from := 0; from < len(region); {
+		start, end, ok := m.occurrence(region[from:], i)
+		if !ok {
+			break
+		}
+		start, end = from+start, from+end
+		if delimited(region, start, end) {
+			return start, end, true
+		}
+		from = start + 1
+	}
+	return 0, 0, false
+}
+
+// occurrence returns the offsets of the first occurrence of the i-th target
+// anywhere in haystack
+func (m *matcher) occurrence(haystack []byte, i int) (int, int, bool) {
+	if m.globs != nil && m.globs[i] != nil {
+		return m.globs[i].find(haystack, ModeAnywhere, 0)
+	}
+
+	var start int
+	switch {
+	case m.equivalents != nil:
+		start = m.equivalents.index(haystack, m.targets[i])
+	case m.caseInsensitive:
+		start = indexBytesIgnoreCase(haystack, m.targets[i])
+	default:
+		start = indexBytes(haystack, m.targets[i])
+	}
+	return start, start + len(m.targets[i]), start >= 0
+}
+
+// boundaryProbability returns the chance that a random neighbour differs in
+// class from a matched character of field that accept accepts
+func boundaryProbability(field Field, accept func(c byte) bool) float64 {
+	var matched [3]float64
+	total := 0.0
+	for class := range matched {
+		matched[class] = fieldProbability(field, func(c byte) bool {
+			return accept(c) && charClass(c) == class
+		})
+		total += matched[class]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	p := 0.0
+	for class, q := range matched {
+		p += q / total * fieldProbability(field, func(c byte) bool {
+			return charClass(c) != class
+		})
+	}
+	return p
+}
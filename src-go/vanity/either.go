@@ -0,0 +1,66 @@
+package vanity
+
+import "fmt"
+
+// newEitherMatcher compiles a ModeEither search as a ModePrefix matcher that
+// falls back to a ModeSuffix one holding only the targets, since everything
+// else about a key is checked once whichever anchor matches. Targets that can
+// never appear at one anchor are only searched at the other.
+func newEitherMatcher(opts Options) (*matcher, error) {
+	if err := validateEither(opts); err != nil {
+		return nil, err
+	}
+
+	start, end := opts, opts
+	start.Mode, end.Mode = ModePrefix, ModeSuffix
+	m, err := newMatcher(start)
+	if err != nil {
+		if m, endErr := newMatcher(end); endErr == nil {
+			return m, nil
+		}
+		return nil, err
+	}
+
+	end.Charsets, end.Randomart, end.FingerprintTargets, end.FingerprintRegex, end.Exclude = nil, nil, nil, "", nil
+	if m.either, err = newMatcher(end); err != nil {
+		// The targets only ever fit at the start
+		m.either = nil
+	}
+	return m, nil
+}
+
+// validateEither reports why opts cannot accept a match at either anchor
+func validateEither(opts Options) error {
+	switch {
+	case opts.Best != nil:
+		return fmt.Errorf("a best-effort search cannot score two anchors at once")
+	case opts.MinScore > 0:
+		return fmt.Errorf("a minimum score cannot be combined with matching at either anchor")
+	case opts.Last > 0:
+		return fmt.Errorf("the last characters only limit matches anywhere in the key, not at either anchor")
+	case opts.Range != nil:
+		return fmt.Errorf("a range only limits matches anywhere in the key, not at either anchor")
+	case opts.MinCount > 1:
+		return fmt.Errorf("repeated occurrences can only be counted anywhere in the key, not at either anchor")
+	}
+	return nil
+}
+
+// eitherProbability estimates a ModeEither search as two independent chances,
+// one per anchor, where an anchor the targets cannot fit counts as zero
+func (opts Options) eitherProbability() (float64, bool) {
+	none := 1.0
+	for _, mode := range []Mode{ModePrefix, ModeSuffix} {
+		anchored := opts
+		anchored.Mode = mode
+		if anchored.Validate() != nil {
+			continue
+		}
+		p, ok := anchored.Probability()
+		if !ok {
+			return 0, false
+		}
+		none *= 1 - p
+	}
+	return 1 - none, true
+}
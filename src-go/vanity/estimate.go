@@ -0,0 +1,378 @@
+package vanity
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Probability estimates the chance that a single generated key satisfies
+// opts, treating every character of the searched text as independent and
+// uniformly distributed over what can appear there. The second result is
+// false when no estimate is possible, as with regular expressions or
+// randomart.
+//
+// With RequireAll the per-target chances multiply, since every target must be
+// present; otherwise any one target is enough and the chances combine as
+// 1 - (1-p1)(1-p2).... With MinScore the chances of each total weight are
+// followed from one target to the next.
+//
+// A Run of one given character is as likely as the equivalent literal
+// target, but a run of any character is far more likely since every
+// character that can be repeated offers another chance.
+//
+// FingerprintTargets are estimated on their own and multiplied in, since the
+// fingerprint is a hash that owes nothing to the characters of the key. A
+// FingerprintRegex cannot be estimated, like any regular expression.
+func (opts Options) Probability() (float64, bool) {
+	if opts.FingerprintRegex != "" {
+		return 0, false
+	}
+	if len(opts.FingerprintTargets) > 0 {
+		p, ok := opts.fingerprintOptions().Probability()
+		if !ok {
+			return 0, false
+		}
+		key := opts
+		key.FingerprintTargets = nil
+		if !key.searchesKey() && len(key.Randomart) == 0 {
+			layout := key.layout()
+			return p * avoidProbability(key, &layout, 0), true
+		}
+		q, ok := key.Probability()
+		return p * q, ok
+	}
+
+	if opts.Regex || len(opts.Randomart) > 0 || !opts.searchesKey() {
+		return 0, false
+	}
+
+	if opts.Mode == ModeEither {
+		return opts.eitherProbability()
+	}
+	if opts.CaseBudget > 0 {
+		opts.CaseInsensitive = true
+	}
+
+	same := opts.sameFunc(opts.CaseInsensitive)
+
+	layout := opts.layout()
+
+	// Character class regions are treated as independent of the rest, and
+	// so are avoided characters, which a match never holds
+	regions := charsetProbability(opts, &layout) * avoidProbability(opts, &layout, coveredLen(opts))
+
+	switch {
+	case opts.Run != nil:
+		return regions * runProbability(*opts.Run, opts, &layout, same), true
+	case opts.Palindrome != 0:
+		return regions * palindromeProbability(opts.Palindrome, opts, &layout, same), true
+	case opts.Pronounceable != 0:
+		return regions * pronounceableProbability(opts.Pronounceable, opts, &layout), true
+	case len(opts.Targets) == 0:
+		return regions, true
+	}
+
+	// The chance of none of them is kept as a logarithm, since 1 - p
+	// rounds to one for long targets
+	all, logNone := 1.0, 0.0
+	var probs []float64
+	for i, target := range opts.Targets {
+		if opts.Field == FieldMD5Fingerprint {
+			target = strings.ReplaceAll(target, ":", "")
+		}
+		p := targetProbability(target, opts, &layout, opts.sameFunc(opts.IgnoresCase(i)))
+		all *= p
+		logNone += math.Log1p(-p)
+		probs = append(probs, p)
+	}
+
+	if opts.MinScore > 0 {
+		return regions * scoreProbability(probs, opts.weight, opts.MinScore), true
+	}
+
+	if opts.RequireAll {
+		return regions * all, true
+	}
+	return regions * -math.Expm1(logNone), true
+}
+
+// sameFunc returns whether two characters match each other, ignoring case
+// as given and equating look-alikes with Options.Confusables
+func (opts Options) sameFunc(ignoreCase bool) func(a, b byte) bool {
+	var equivalents *equivalenceTable
+	if opts.Confusables {
+		equivalents = newEquivalenceTable(ignoreCase)
+	}
+	return func(a, b byte) bool {
+		switch {
+		case equivalents != nil:
+			return equivalents[a] == equivalents[b]
+		case ignoreCase:
+			return toLowerCase(a) == toLowerCase(b)
+		}
+		return a == b
+	}
+}
+
+// ExpectedAttempts returns the mean number of keys generated before one
+// satisfies opts, or false when Probability cannot estimate it
+func (opts Options) ExpectedAttempts() (float64, bool) {
+	p, ok := opts.Probability()
+	if !ok || p <= 0 {
+		return 0, false
+	}
+	return 1 / p, true
+}
+
+// targetProbability estimates the chance that target appears where opts
+// allow it in a single key
+func targetProbability(target string, opts Options, layout *keyLayout, same func(a, b byte) bool) float64 {
+	atoms, _ := parseTarget(target)
+
+	// What a Bubble Babble digest holds depends on the position, so every
+	// offset a match may start at is estimated on its own
+	if opts.Field == FieldBubbleBabble && !opts.Subsequence {
+		return bubbleBabbleProbability(atoms, opts, layout, same)
+	}
+
+	q := matchProbability(atoms, opts, layout, same, -1)
+	if opts.Subsequence || opts.Mode != ModeAnywhere {
+		return q
+	}
+
+	// Every start position is another chance to find the target
+	positions := anywhereLen(opts, layout) - minTargetLen(atoms) + 1
+	if opts.Range != nil {
+		positions = rangePositions(*opts.Range, minTargetLen(atoms), anywhereLen(opts, layout))
+	}
+	if positions <= 0 {
+		return 0
+	}
+	if opts.MinCount > 1 {
+		return repeatProbability(q, positions, opts.MinCount)
+	}
+	// 1 - (1-q)^positions, which would round to zero for long targets
+	return -math.Expm1(float64(positions) * math.Log1p(-q))
+}
+
+// bubbleBabbleProbability estimates the chance that atoms appear where opts
+// allow them in a Bubble Babble digest, from the characters each offset can
+// hold. Runs are taken to match nothing.
+func bubbleBabbleProbability(atoms []atom, opts Options, layout *keyLayout, same func(a, b byte) bool) float64 {
+	first, last := bubbleBabbleOffsets(minTargetLen(atoms), opts)
+	if last < first {
+		return 0
+	}
+	sum, logNone := 0.0, 0.0
+	for offset := first; offset <= last; offset++ {
+		q := matchProbability(atoms, opts, layout, same, offset)
+		sum += q
+		logNone += math.Log1p(-q)
+	}
+	if opts.MinCount > 1 {
+		positions := last - first + 1
+		return repeatProbability(sum/float64(positions), positions, opts.MinCount)
+	}
+	return -math.Expm1(logNone)
+}
+
+// matchProbability estimates the chance that atoms match at a single start
+// position, or anywhere at all for a subsequence. Offset is where that
+// position lies in a Bubble Babble digest, and negative for other fields.
+func matchProbability(atoms []atom, opts Options, layout *keyLayout, same func(a, b byte) bool, offset int) float64 {
+	// Anchored characters at the edges of the region have fewer possible values
+	firstChars, lastChars := "", ""
+	switch {
+	case opts.Field == FieldKey && (opts.Mode == ModePrefix || opts.Mode == ModeAt && opts.At == 0):
+		firstChars = layout.firstChars
+	case opts.Field == FieldKey && opts.Mode == ModeSuffix:
+		lastChars = layout.lastChars
+	case opts.Field == FieldFingerprint && opts.Mode == ModeSuffix:
+		lastChars = lastFingerprintChars
+	}
+
+	// The chance that each position matches, and that the neighbours of a
+	// delimited match differ in class from its edges
+	var probs, exact []float64
+	boundaries := 1.0
+	pos := 0
+	for i, a := range atoms {
+		// A character matches its equivalents, or just itself when escaped,
+		// and a class matches whatever any of its members would
+		members := a.members()
+		accept := func(c byte) bool {
+			if a.exact {
+				return c == a.char
+			}
+			for j := 0; j < len(members); j++ {
+				if same(c, members[j]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		chance := func(accept func(c byte) bool) float64 {
+			switch {
+			case offset >= 0:
+				return setProbability(bubbleBabbleChars(offset+pos), accept)
+			case i == 0 && firstChars != "":
+				return setProbability(firstChars, accept)
+			case i == len(atoms)-1 && lastChars != "":
+				return setProbability(lastChars, accept)
+			}
+			return fieldProbability(opts.Field, accept)
+		}
+
+		// Wildcards match anything, or nothing at all
+		if a.kind != atomAny && a.kind != atomRun {
+			probs = append(probs, chance(accept))
+			if opts.CaseBudget > 0 {
+				exact = append(exact, chance(func(c byte) bool { return c == a.char }))
+			}
+		}
+
+		// Anchors at the edge of the region need no neighbour there
+		if opts.Delimited && (a.kind == atomChar || a.kind == atomClass) {
+			if i == 0 && opts.Mode != ModePrefix && !(opts.Mode == ModeAt && opts.At == 0) {
+				boundaries *= boundaryProbability(opts.Field, accept)
+			}
+			if i == len(atoms)-1 && opts.Mode != ModeSuffix {
+				boundaries *= boundaryProbability(opts.Field, accept)
+			}
+		}
+
+		if a.kind != atomRun {
+			pos++
+		}
+	}
+	if opts.Subsequence {
+		return subsequenceProbability(probs, anywhereLen(opts, layout))
+	}
+
+	q := mismatchProbability(probs, opts.MaxMismatch) * boundaries
+	if opts.CaseBudget > 0 {
+		q = budgetProbability(probs, exact, opts.MaxMismatch, opts.CaseBudget) * boundaries
+	}
+
+	if opts.MaxGaps > 0 {
+		q *= gapFactor(len(probs), opts.MaxGaps, fieldProbability(opts.Field, isSymbol))
+	}
+	return q
+}
+
+// repeatProbability estimates the chance of at least count occurrences when
+// each of positions has chance q of starting one. Occurrences are treated as
+// independent, a Poisson approximation that holds while q is small. The tail
+// is summed directly, since subtracting the likely counts from one would lose
+// all precision for long targets.
+func repeatProbability(q float64, positions, count int) float64 {
+	lambda := q * float64(positions)
+	term := math.Exp(-lambda)
+	for k := 1; k <= count; k++ {
+		term *= lambda / float64(k)
+	}
+
+	p := 0.0
+	for k := count; term > p*1e-12 && k < count+1000; k++ {
+		p += term
+		term *= lambda / float64(k+1)
+	}
+	return p
+}
+
+// fieldProbability returns how often a random position of field holds a
+// character that accept accepts
+func fieldProbability(field Field, accept func(c byte) bool) float64 {
+	switch field {
+	case FieldMD5Fingerprint, FieldHex:
+		return setProbability(hexAlphabet, accept)
+	case FieldBubbleBabble:
+		// Each six-character round is vowel, consonant, vowel, consonant,
+		// dash, consonant; the rare 'x' at the edges is counted as a
+		// consonant
+		return setProbability(bubbleVowels, accept)*2/6 +
+			setProbability(bubbleConsonants, accept)*3/6 +
+			setProbability("-", accept)/6
+	}
+	return setProbability(base64Alphabet, accept)
+}
+
+// setProbability returns the share of set that accept accepts
+func setProbability(set string, accept func(c byte) bool) float64 {
+	n := 0
+	for i := 0; i < len(set); i++ {
+		if accept(set[i]) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(set))
+}
+
+// runProbability estimates the chance that run appears in a single key
+func runProbability(run Run, opts Options, layout *keyLayout, same func(a, b byte) bool) float64 {
+	if run.Char != 0 {
+		return targetProbability(strings.Repeat(string(run.Char), run.Length), opts, layout, same)
+	}
+
+	alphabet := base64Alphabet
+	switch opts.Field {
+	case FieldMD5Fingerprint, FieldHex:
+		alphabet = hexAlphabet
+	case FieldBubbleBabble:
+		alphabet = bubbleBabbleAlphabet
+	}
+
+	// Sum the chance of a run of each distinct character at one position
+	q := 0.0
+	for i := 0; i < len(alphabet); i++ {
+		distinct := true
+		for j := 0; j < i; j++ {
+			if same(alphabet[i], alphabet[j]) {
+				distinct = false
+				break
+			}
+		}
+		if distinct {
+			c := alphabet[i]
+			p := fieldProbability(opts.Field, func(x byte) bool { return same(x, c) })
+			q += math.Pow(p, float64(run.Length))
+		}
+	}
+
+	positions := anywhereLen(opts, layout) - run.Length + 1
+	if positions <= 0 {
+		return 0
+	}
+	return 1 - math.Pow(1-q, float64(positions))
+}
+
+// MeasureRate runs the search opts describe for duration and returns how many
+// keys a second it generated and checked. Matches found along the way are
+// thrown away and the search carries on, so easy targets measure the same as
+// hard ones. Options.MaxAttempts, Attempts, Best and OnProgress are ignored.
+func MeasureRate(ctx context.Context, opts Options, duration time.Duration) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	attempts := new(uint64)
+	opts.Attempts = attempts
+	opts.MaxAttempts = 0
+	opts.Best = nil
+	opts.OnProgress = nil
+
+	start := time.Now()
+	for ctx.Err() == nil {
+		if _, err := Search(ctx, opts); err != nil && ctx.Err() == nil {
+			return 0, err
+		}
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return 0, ctx.Err()
+	}
+	return float64(atomic.LoadUint64(attempts)) / time.Since(start).Seconds(), nil
+}
@@ -0,0 +1,137 @@
+package vanity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateFuzzy reports why opts cannot allow mismatched characters. Only
+// plain literal targets are compared position by position.
+func validateFuzzy(opts Options) error {
+	switch {
+	case opts.MaxMismatch < 0:
+		return fmt.Errorf("the number of mismatched characters to allow cannot be negative")
+	case opts.Regex:
+		return fmt.Errorf("mismatched characters cannot be allowed in regular expressions")
+	case len(opts.Targets) == 0:
+		return fmt.Errorf("mismatched characters can only be allowed in target sequences")
+	case opts.MinCount > 1:
+		return fmt.Errorf("occurrences of a target with mismatched characters cannot be counted")
+	case opts.Best != nil:
+		return fmt.Errorf("a best-effort search cannot score targets with mismatched characters")
+	}
+
+	for _, target := range opts.Targets {
+		if hasPatterns(target) || hasCaseEscapes(target) {
+			return fmt.Errorf("target sequence %q uses wildcards, character classes or case escapes, which cannot be combined with mismatched characters", target)
+		}
+		if opts.Field == FieldMD5Fingerprint {
+			target = strings.ReplaceAll(target, ":", "")
+		}
+		if len(target) <= opts.MaxMismatch {
+			return fmt.Errorf("target sequence %q would match anything with %d mismatched characters allowed", target, opts.MaxMismatch)
+		}
+	}
+	return nil
+}
+
+// fuzzy matches a literal target within a window of the same length where
+// up to maxMismatch characters may differ, and with a case budget, up to
+// caseBudget more may match only in another case than typed
+type fuzzy struct {
+	target      []byte // canonical through fold
+	maxMismatch int
+	fold        *equivalenceTable
+	raw         []byte // as typed, set for Options.CaseBudget
+	caseBudget  int
+}
+
+// within reports whether window differs from the target in at most
+// maxMismatch characters, and in case in at most caseBudget of the others,
+// giving up as soon as it differs in more
+func (f *fuzzy) within(window []byte) bool {
+	mismatches, deviations := 0, 0
+	for j, c := range f.target {
+		switch {
+		case f.fold[window[j]] != c:
+			mismatches++
+			if mismatches > f.maxMismatch {
+				return false
+			}
+		case f.raw != nil && window[j] != f.raw[j]:
+			deviations++
+			if deviations > f.caseBudget {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// mismatched returns the offsets into the target of every character window
+// differs in
+func (f *fuzzy) mismatched(window []byte) []int {
+	var offsets []int
+	for j, c := range f.target {
+		if f.fold[window[j]] != c {
+			offsets = append(offsets, j)
+		}
+	}
+	return offsets
+}
+
+// deviated returns the offsets into the target of every character window
+// matches only in another case than typed, or nil without a case budget
+func (f *fuzzy) deviated(window []byte) []int {
+	if f.raw == nil {
+		return nil
+	}
+	var offsets []int
+	for j, c := range f.target {
+		if f.fold[window[j]] == c && window[j] != f.raw[j] {
+			offsets = append(offsets, j)
+		}
+	}
+	return offsets
+}
+
+// find returns the offsets of the first window of region close enough to the
+// target, anchored as mode requires
+func (f *fuzzy) find(region []byte, mode Mode, at int) (int, int, bool) {
+	n := len(f.target)
+	first, last := 0, len(region)-n
+	switch mode {
+	case ModePrefix, ModeAt:
+		first, last = at, at
+	case ModeSuffix:
+		first = last
+	}
+	for i := max(first, 0); i <= last; i++ {
+		if f.within(region[i : i+n]) {
+			return i, i + n, true
+		}
+	}
+	return 0, 0, false
+}
+
+// mismatchProbability returns the chance that at most k of a window's
+// positions fail to match, when position j matches with chance probs[j]
+func mismatchProbability(probs []float64, k int) float64 {
+	// within[m] is the chance of exactly m mismatches so far
+	within := make([]float64, k+1)
+	within[0] = 1
+	for _, p := range probs {
+		for m := k; m >= 0; m-- {
+			within[m] *= p
+			if m > 0 {
+				within[m] += within[m-1] * (1 - p)
+			}
+		}
+	}
+
+	total := 0.0
+	for _, p := range within {
+		total += p
+	}
+	return total
+}
@@ -0,0 +1,294 @@
+package vanity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Literal targets may contain these wildcards. Neither can ever appear in a
+// key or fingerprint, so they never need escaping.
+const (
+	wildcardAny = '?' // any single character
+	wildcardRun = '*' // any run of characters, including none
+)
+
+// Literal targets may also contain character classes such as [o0] or [4-6],
+// matching any one of the characters listed. Brackets never appear in a key
+// or fingerprint either.
+const (
+	classOpen  = '['
+	classClose = ']'
+	classRange = '-'
+)
+
+// hasPatterns reports whether target uses any wildcard or character class
+func hasPatterns(target string) bool {
+	return strings.ContainsAny(target, "?*[")
+}
+
+// caseEscape marks the next character of a target as matching its exact
+// case even when case is otherwise ignored, as in `\Yegor`
+const caseEscape = '\\'
+
+// hasCaseEscapes reports whether target fixes the case of any character
+func hasCaseEscapes(target string) bool {
+	return strings.IndexByte(target, caseEscape) >= 0
+}
+
+// unescape removes the case escapes from target
+func unescape(target string) string {
+	return strings.ReplaceAll(target, string(caseEscape), "")
+}
+
+// atomKind tells the elements of a literal target apart
+type atomKind int
+
+const (
+	atomChar  atomKind = iota // a single character
+	atomAny                   // '?'
+	atomRun                   // '*'
+	atomClass                 // a bracketed character class
+)
+
+// classItem is a character, or an inclusive range of them when lo < hi,
+// listed in a character class
+type classItem struct {
+	lo, hi byte
+	pos    int // offset within the target, for error messages
+}
+
+// atom is one element of a parsed literal target
+type atom struct {
+	kind  atomKind
+	char  byte        // the character of an atomChar
+	exact bool        // set for an atomChar escaped to match in exact case
+	items []classItem // the contents of an atomClass
+	pos   int         // offset within the target, for error messages
+	text  string      // the atom as written, brackets included
+}
+
+// quote formats the atom for error messages
+func (a atom) quote() string {
+	if a.kind == atomChar {
+		return fmt.Sprintf("%q", a.char)
+	}
+	return fmt.Sprintf("%q", a.text)
+}
+
+// members returns every character an atomChar or atomClass stands for
+func (a atom) members() string {
+	if a.kind == atomChar {
+		return string(a.char)
+	}
+	var b strings.Builder
+	for _, item := range a.items {
+		for c := int(item.lo); c <= int(item.hi); c++ {
+			b.WriteByte(byte(c))
+		}
+	}
+	return b.String()
+}
+
+// parseTarget splits a literal target into atoms, reporting misplaced case
+// escapes and malformed character classes
+func parseTarget(target string) ([]atom, error) {
+	var atoms []atom
+	for i := 0; i < len(target); i++ {
+		switch c := target[i]; c {
+		case wildcardAny:
+			atoms = append(atoms, atom{kind: atomAny, pos: i})
+		case wildcardRun:
+			atoms = append(atoms, atom{kind: atomRun, pos: i})
+		case caseEscape:
+			if i+1 == len(target) || strings.IndexByte("?*[\\", target[i+1]) >= 0 {
+				return nil, fmt.Errorf("target sequence %q has a backslash that is not followed by a character to match in exact case", target)
+			}
+			i++
+			atoms = append(atoms, atom{kind: atomChar, char: target[i], exact: true, pos: i})
+		case classOpen:
+			end := strings.IndexByte(target[i+1:], classClose)
+			if end < 0 {
+				return nil, fmt.Errorf("target sequence %q has a '[' at position %d without a closing ']'", target, i)
+			}
+			class := atom{kind: atomClass, pos: i, text: target[i : i+2+end]}
+			body := target[i+1 : i+1+end]
+			if body == "" {
+				return nil, fmt.Errorf("target sequence %q has an empty character class at position %d", target, i)
+			}
+			for j := 0; j < len(body); j++ {
+				pos := i + 1 + j
+				if body[j] == caseEscape {
+					return nil, fmt.Errorf("target sequence %q has a backslash at position %d inside a character class, where it has no meaning", target, pos)
+				}
+				// A '-' at either end of the class stands for itself
+				if j+2 < len(body) && body[j+1] == classRange {
+					lo, hi := body[j], body[j+2]
+					if lo > hi {
+						return nil, fmt.Errorf("target sequence %q has the range %c-%c at position %d running backwards", target, lo, hi, pos)
+					}
+					class.items = append(class.items, classItem{lo: lo, hi: hi, pos: pos})
+					j += 2
+					continue
+				}
+				class.items = append(class.items, classItem{lo: body[j], hi: body[j], pos: pos})
+			}
+			atoms = append(atoms, class)
+			i += 1 + end
+		default:
+			atoms = append(atoms, atom{kind: atomChar, char: c, pos: i})
+		}
+	}
+	return atoms, nil
+}
+
+// minTargetLen returns the fewest characters the atoms of a target can match
+func minTargetLen(atoms []atom) int {
+	n := 0
+	for _, a := range atoms {
+		if a.kind != atomRun {
+			n++
+		}
+	}
+	return n
+}
+
+// byteSet holds the characters one position of a glob accepts
+type byteSet [256]bool
+
+// glob matches a target containing wildcards, character classes or case
+// escapes. The target is split at each '*' into segments that must appear in
+// order, and every other atom becomes the set of characters its position
+// accepts, so comparing a segment is a single lookup per character whatever
+// the folding.
+type glob struct {
+	segments [][]byteSet
+}
+
+// newGlob compiles the atoms of a target, comparing characters through fold
+// unless they are escaped to match exactly
+func newGlob(atoms []atom, mode Mode, fold *equivalenceTable) *glob {
+	// Leading and trailing runs add nothing when the target may appear
+	// anywhere, and trimming them keeps the reported match tight
+	if mode == ModeAnywhere {
+		for len(atoms) > 0 && atoms[0].kind == atomRun {
+			atoms = atoms[1:]
+		}
+		for len(atoms) > 0 && atoms[len(atoms)-1].kind == atomRun {
+			atoms = atoms[:len(atoms)-1]
+		}
+	}
+
+	g := &glob{segments: [][]byteSet{nil}}
+	for _, a := range atoms {
+		if a.kind == atomRun {
+			g.segments = append(g.segments, nil)
+			continue
+		}
+
+		var set byteSet
+		switch {
+		case a.kind == atomAny:
+			for c := range set {
+				set[c] = true
+			}
+		case a.exact:
+			set[a.char] = true
+		default:
+			members := a.members()
+			for c := range set {
+				set[c] = fold.contains(members, byte(c))
+			}
+		}
+		last := len(g.segments) - 1
+		g.segments[last] = append(g.segments[last], set)
+	}
+	return g
+}
+
+// foldTable returns the table globs compare characters through: the
+// equivalences when given, otherwise ASCII lowercase or the identity
+func foldTable(caseInsensitive bool, equivalents *equivalenceTable) *equivalenceTable {
+	if equivalents != nil {
+		return equivalents
+	}
+	var t equivalenceTable
+	for i := range t {
+		t[i] = byte(i)
+		if caseInsensitive {
+			t[i] = toLowerCase(byte(i))
+		}
+	}
+	return &t
+}
+
+// segmentAt reports whether the k-th segment matches haystack at offset i
+func (g *glob) segmentAt(haystack []byte, i, k int) bool {
+	segment := g.segments[k]
+	if i < 0 || i+len(segment) > len(haystack) {
+		return false
+	}
+	for j := range segment {
+		if !segment[j][haystack[i+j]] {
+			return false
+		}
+	}
+	return true
+}
+
+// index returns the first offset from onwards where the k-th segment
+// matches haystack, or -1
+func (g *glob) index(haystack []byte, k, from int) int {
+	for i := from; i+len(g.segments[k]) <= len(haystack); i++ {
+		if g.segmentAt(haystack, i, k) {
+			return i
+		}
+	}
+	return -1
+}
+
+// find returns the start and end offsets of the leftmost match in region,
+// anchored as mode requires. ModePrefix and ModeAt pin the first segment to
+// offset at, and ModeSuffix pins the last one to the end of region.
+func (g *glob) find(region []byte, mode Mode, at int) (int, int, bool) {
+	first, last := 0, len(g.segments)-1
+	limit := len(region)
+
+	if mode == ModeSuffix {
+		limit -= len(g.segments[last])
+		if !g.segmentAt(region, limit, last) {
+			return 0, 0, false
+		}
+		last--
+	}
+
+	// Earlier segments may not overlap a segment pinned to the end
+	searched := region[:limit]
+
+	start, pos := -1, 0
+	if mode == ModePrefix || mode == ModeAt {
+		if !g.segmentAt(searched, at, first) {
+			return 0, 0, false
+		}
+		start, pos = at, at+len(g.segments[first])
+		first++
+	}
+
+	for k := first; k <= last; k++ {
+		i := g.index(searched, k, pos)
+		if i < 0 {
+			return 0, 0, false
+		}
+		if start < 0 {
+			start = i
+		}
+		pos = i + len(g.segments[k])
+	}
+
+	if mode == ModeSuffix {
+		if start < 0 {
+			start = limit
+		}
+		pos = len(region)
+	}
+	return start, pos, true
+}
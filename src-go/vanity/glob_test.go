@@ -0,0 +1,75 @@
+package vanity
+
+import "testing"
+
+func TestGlobFind(t *testing.T) {
+	// Offsets:            0123456789ab
+	const region = "xxabcyyabczz"
+
+	for _, tc := range []struct {
+		target     string
+		mode       Mode
+		at         int
+		ci         bool
+		region     string // when not region
+		start, end int
+		ok         bool
+	}{
+		// Anywhere
+		{target: "ab?", mode: ModeAnywhere, start: 2, end: 5, ok: true},
+		{target: "a*z", mode: ModeAnywhere, start: 2, end: 11, ok: true},
+		{target: "*bc", mode: ModeAnywhere, start: 3, end: 5, ok: true}, // runs at the ends are trimmed
+		{target: "**b*", mode: ModeAnywhere, start: 3, end: 4, ok: true},
+		{target: "bc*", mode: ModeAnywhere, start: 3, end: 5, ok: true},
+		{target: "b*y*z", mode: ModeAnywhere, start: 3, end: 11, ok: true},
+		{target: "q*", mode: ModeAnywhere},
+		{target: "a?c", mode: ModeAnywhere, ci: true, region: "xxABCyy", start: 2, end: 5, ok: true},
+		{target: "a?c", mode: ModeAnywhere, region: "xxABCyy"},
+
+		// Prefix and suffix keep runs at the ends, which stretch the match to
+		// the edge of the region
+		{target: "xxa?c", mode: ModePrefix, start: 0, end: 5, ok: true},
+		{target: "xx*", mode: ModePrefix, start: 0, end: 2, ok: true},
+		{target: "*zz", mode: ModePrefix, start: 0, end: 12, ok: true},
+		{target: "x*", mode: ModePrefix, start: 0, end: 1, ok: true},
+		{target: "ab*", mode: ModePrefix},
+		{target: "?a", mode: ModePrefix},
+		{target: "XX?b", mode: ModePrefix, ci: true, start: 0, end: 4, ok: true},
+
+		// At
+		{target: "ab?", mode: ModeAt, at: 7, start: 7, end: 10, ok: true},
+		{target: "a*z", mode: ModeAt, at: 7, start: 7, end: 11, ok: true},
+		{target: "*c", mode: ModeAt, at: 7, start: 7, end: 10, ok: true},
+		{target: "ab?", mode: ModeAt, at: 6},
+
+		// Suffix; earlier segments may not overlap the one pinned to the end
+		{target: "zz", mode: ModeSuffix, start: 10, end: 12, ok: true},
+		{target: "c?z", mode: ModeSuffix, start: 9, end: 12, ok: true},
+		{target: "?", mode: ModeSuffix, start: 11, end: 12, ok: true},
+		{target: "*zz", mode: ModeSuffix, start: 0, end: 12, ok: true},
+		{target: "*z", mode: ModeSuffix, start: 0, end: 12, ok: true},
+		{target: "c*", mode: ModeSuffix, start: 4, end: 12, ok: true},
+		{target: "a*z", mode: ModeSuffix, start: 2, end: 12, ok: true},
+		{target: "a*c", mode: ModeSuffix},
+		{target: "bcz", mode: ModeSuffix},
+		{target: "z?", mode: ModeSuffix, start: 10, end: 12, ok: true},
+		{target: "c*zz?", mode: ModeSuffix},
+		{target: "ZZ", mode: ModeSuffix, ci: true, start: 10, end: 12, ok: true},
+		{target: "ZZ", mode: ModeSuffix},
+	} {
+		haystack := region
+		if tc.region != "" {
+			haystack = tc.region
+		}
+		atoms, err := parseTarget(tc.target)
+		if err != nil {
+			t.Fatalf("parseTarget(%q): %v", tc.target, err)
+		}
+		g := newGlob(atoms, tc.mode, foldTable(tc.ci, nil))
+		start, end, ok := g.find([]byte(haystack), tc.mode, tc.at)
+		if ok != tc.ok || ok && (start != tc.start || end != tc.end) {
+			t.Errorf("%q in %q, mode %v at %d, ci %v: find = %d, %d, %v; want %d, %d, %v",
+				tc.target, haystack, tc.mode, tc.at, tc.ci, start, end, ok, tc.start, tc.end, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package vanity
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Job is one of several searches SearchJobs runs over a single stream of
+// keys. Everything but its targets and their case comes from the Options the
+// jobs share.
+type Job struct {
+	Targets []string
+	Case    Case // CaseDefault follows Options.CaseInsensitive
+}
+
+// Options returns the search j stands for on its own, on top of the options
+// it shares with the other jobs
+func (j Job) Options(shared Options) Options {
+	opts := shared
+	opts.Targets = j.Targets
+	opts.TargetCases, opts.Weights = nil, nil
+	switch j.Case {
+	case CaseSensitive:
+		opts.CaseInsensitive, opts.SmartCase = false, false
+	case CaseInsensitive:
+		opts.CaseInsensitive, opts.SmartCase = true, false
+	}
+	return opts
+}
+
+// SearchJobs generates keys until each of jobs has a key of its own, checking
+// every key against all the jobs still waiting, so a team's keys take little
+// longer to find than the hardest of them alone. Each key is handed to found
+// as soon as it turns up, from the goroutine that called SearchJobs, with
+// Result.Job giving the index of its job. A key never serves two jobs.
+//
+// When ctx is cancelled or Options.MaxAttempts is reached first, SearchJobs
+// returns ctx.Err() or ErrMaxAttempts and the jobs without a key are left
+// unserved. Best-effort searches and word hunts cannot be shared.
+func SearchJobs(ctx context.Context, opts Options, jobs []Job, found func(*Result)) error {
+	switch {
+	case len(jobs) == 0:
+		return fmt.Errorf("no jobs to search for")
+	case opts.Best != nil || len(opts.Words) > 0:
+		return fmt.Errorf("best-effort searches and word hunts cannot be shared between jobs")
+	}
+
+	ms := make([]*matcher, len(jobs))
+	for i, job := range jobs {
+		m, err := newMatcher(job.Options(opts))
+		if err != nil {
+			return fmt.Errorf("job %d: %v", i+1, err)
+		}
+		ms[i] = m
+	}
+	if opts.Attempts == nil {
+		opts.Attempts = new(uint64)
+	}
+
+	// Workers skip the jobs marked done, though one may still be offered a
+	// key it no longer needs before seeing the mark
+	done := make([]atomic.Bool, len(jobs))
+	seen := make(map[string]bool)
+	remaining := len(jobs)
+	return runWorkers(ctx, opts, ms, done, true, func(r Result) bool {
+		if done[r.Job].Load() || seen[r.AuthorizedKey] {
+			return false
+		}
+		done[r.Job].Store(true)
+		seen[r.AuthorizedKey] = true
+		remaining--
+
+		r.TotalAttempts = atomic.LoadUint64(opts.Attempts)
+		found(&r)
+		return remaining == 0
+	})
+}
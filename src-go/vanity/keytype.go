@@ -0,0 +1,254 @@
+package vanity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyType selects the algorithm of the generated keys
+type KeyType int
+
+const (
+	KeyEd25519 KeyType = iota
+	KeyRSA
+	KeyECDSA
+)
+
+// DefaultRSABits is the RSA modulus size used when Options.Bits is zero
+const DefaultRSABits = 3072
+
+// minRSABits is the smallest modulus crypto/rsa agrees to generate
+const minRSABits = 1024
+
+// keyLayout describes the parts of an authorized_keys line that do not depend
+// on the key material. Every line starts with the key type and a single space,
+// followed by the base64-encoded key blob and a newline.
+type keyLayout struct {
+	typePrefix string // key type followed by a space, e.g. "ssh-ed25519 "
+	header     string // base64 characters fixed by the key type and size
+	firstChars string // characters that can directly follow header
+	lastChars  string // characters that can end the body
+	bodyLen    int    // base64 characters in the body, excluding padding
+	padding    int    // '=' characters after the body
+}
+
+// variableLen returns the length of the part of the body following the fixed
+// header, the only part that depends on the key material
+func (l *keyLayout) variableLen() int {
+	return l.bodyLen - len(l.header)
+}
+
+// body returns the base64 key body of an authorized_keys line, without any
+// padding. The key type prefix and the body have fixed lengths for a given
+// layout, so the bounds never depend on the key material.
+func (l *keyLayout) body(line []byte) []byte {
+	return line[len(l.typePrefix) : len(l.typePrefix)+l.bodyLen]
+}
+
+// newKeyLayout derives the layout of keys whose blob is blobLen bytes long and
+// starts with the bytes in fixed. The first byte after fixed is known to lie
+// between lo and hi, and the bits of the last byte selected by lastMask always
+// equal lastBits.
+func newKeyLayout(keyType string, fixed []byte, lo, hi byte, blobLen int, lastMask, lastBits byte) keyLayout {
+	l := keyLayout{
+		typePrefix: keyType + " ",
+		bodyLen:    base64.RawStdEncoding.EncodedLen(blobLen),
+	}
+	l.padding = base64.StdEncoding.EncodedLen(blobLen) - l.bodyLen
+
+	// Each character holds six bits, so the header ends with the last
+	// character made up entirely of fixed bits. The one after it mixes any
+	// leftover fixed bits with the top of the first variable byte.
+	headerLen := len(fixed) * 8 / 6
+	l.header = base64.RawStdEncoding.EncodeToString(fixed)[:headerLen]
+
+	next := append(fixed[:len(fixed):len(fixed)], 0)
+	for b := int(lo); b <= int(hi); b++ {
+		next[len(fixed)] = byte(b)
+		c := base64.RawStdEncoding.EncodeToString(next)[headerLen]
+		if l.firstChars == "" || l.firstChars[len(l.firstChars)-1] != c {
+			l.firstChars += string(c)
+		}
+	}
+
+	// The final character only carries the low bits of the last byte when
+	// the blob length is not a multiple of three, padded with zero bits
+	tail := make([]byte, 3-(3-blobLen%3)%3)
+	seen := make(map[byte]bool)
+	for b := 0; b < 256; b++ {
+		if byte(b)&lastMask != lastBits {
+			continue
+		}
+		tail[len(tail)-1] = byte(b)
+		encoded := base64.RawStdEncoding.EncodeToString(tail)
+		seen[encoded[len(encoded)-1]] = true
+	}
+	for i := 0; i < len(base64Alphabet); i++ {
+		if seen[base64Alphabet[i]] {
+			l.lastChars += base64Alphabet[i : i+1]
+		}
+	}
+
+	return l
+}
+
+// appendSSHString appends s in the length-prefixed SSH wire format
+func appendSSHString(dst []byte, s string) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(s)))
+	return append(dst, s...)
+}
+
+// ed25519BlobHeader starts the wire blob of every ed25519 key: the key type
+// and the length of the public key that follows, as SSH strings
+var ed25519BlobHeader = binary.BigEndian.AppendUint32(appendSSHString(nil, ssh.KeyAlgoED25519), ed25519.PublicKeySize)
+
+// ed25519Layout describes ed25519 keys. The 51-byte blob base64-encodes to
+// exactly 68 characters without any '=' padding, so every base64 symbol can
+// end the body. The 25-character header encodes the key type and length, and
+// the character after it combines the last two (zero) bits of the length
+// with the top four bits of the public key, so it is always one of A-P.
+var ed25519Layout = newKeyLayout(ssh.KeyAlgoED25519, ed25519BlobHeader,
+	0, 255, 4+len(ssh.KeyAlgoED25519)+4+ed25519.PublicKeySize, 0, 0)
+
+// rsaLayout describes RSA keys with a bits-bit modulus. The blob holds the
+// public exponent and then the modulus as SSH mpints. crypto/rsa always sets
+// the top bit of the modulus, which then needs a leading zero byte whenever
+// bits is a multiple of eight, and picks both primes congruent to 7 mod 8, so
+// the modulus is always 1 mod 8.
+func rsaLayout(bits int) keyLayout {
+	modulusLen := (bits + 7) / 8
+	lo, hi := byte(1)<<((bits-1)%8), byte(1<<((bits-1)%8+1)-1)
+
+	fixed := appendSSHString(nil, ssh.KeyAlgoRSA)
+	fixed = appendSSHString(fixed, "\x01\x00\x01") // crypto/rsa always uses e = 65537
+	if bits%8 == 0 {
+		fixed = binary.BigEndian.AppendUint32(fixed, uint32(modulusLen+1))
+		fixed = append(fixed, 0)
+	} else {
+		fixed = binary.BigEndian.AppendUint32(fixed, uint32(modulusLen))
+	}
+
+	return newKeyLayout(ssh.KeyAlgoRSA, fixed, lo, hi, len(fixed)+modulusLen, 7, 1)
+}
+
+// ecdsaLayout describes ECDSA keys on curve. The blob holds the curve name
+// twice, in the key type and on its own, followed by the point in
+// uncompressed form: a 0x04 byte and then both coordinates, padded to the
+// byte size of the curve. Only P-521 leaves spare bits, which are always zero
+// at the top of the first coordinate.
+func ecdsaLayout(curve elliptic.Curve) keyLayout {
+	bits := curve.Params().BitSize
+	coordLen := (bits + 7) / 8
+	hi := byte(1<<((bits-1)%8+1) - 1)
+
+	keyType, curveName := ecdsaNames(curve)
+	fixed := appendSSHString(nil, keyType)
+	fixed = appendSSHString(fixed, curveName)
+	fixed = binary.BigEndian.AppendUint32(fixed, uint32(1+2*coordLen))
+	fixed = append(fixed, 4)
+
+	return newKeyLayout(keyType, fixed, 0, hi, len(fixed)+2*coordLen, 0, 0)
+}
+
+// ecdsaNames returns the SSH key type and curve name of curve, or empty
+// strings when SSH does not support it
+func ecdsaNames(curve elliptic.Curve) (string, string) {
+	switch curve {
+	case elliptic.P256():
+		return ssh.KeyAlgoECDSA256, "nistp256"
+	case elliptic.P384():
+		return ssh.KeyAlgoECDSA384, "nistp384"
+	case elliptic.P521():
+		return ssh.KeyAlgoECDSA521, "nistp521"
+	}
+	return "", ""
+}
+
+// layout returns the authorized_keys layout of the keys opts generate
+func (opts Options) layout() keyLayout {
+	switch opts.KeyType {
+	case KeyRSA:
+		return rsaLayout(opts.rsaBits())
+	case KeyECDSA:
+		return ecdsaLayout(opts.ecdsaCurve())
+	}
+	return ed25519Layout
+}
+
+// rsaBits returns the RSA modulus size, applying DefaultRSABits
+func (opts Options) rsaBits() int {
+	if opts.Bits == 0 {
+		return DefaultRSABits
+	}
+	return opts.Bits
+}
+
+// ecdsaCurve returns the ECDSA curve, applying the P-256 default
+func (opts Options) ecdsaCurve() elliptic.Curve {
+	if opts.Curve == nil {
+		return elliptic.P256()
+	}
+	return opts.Curve
+}
+
+// validateKey reports why opts do not describe keys that can be generated
+func (opts Options) validateKey() error {
+	if opts.KeyType != KeyRSA && opts.Bits != 0 {
+		return fmt.Errorf("a key size only applies to RSA; ed25519 keys have a fixed size and ECDSA keys take theirs from the curve")
+	}
+	if opts.KeyType != KeyECDSA && opts.Curve != nil {
+		return fmt.Errorf("a curve only applies to ECDSA keys")
+	}
+	if opts.KeyType != KeyEd25519 && opts.Field == FieldHex {
+		return fmt.Errorf("only ed25519 public keys are a plain 32 bytes to search as hex")
+	}
+	if opts.KeyType != KeyEd25519 && opts.Seed != nil {
+		// Both packages deliberately mix in extra randomness
+		return fmt.Errorf("a seed only makes ed25519 keys reproducible; crypto/rsa and crypto/ecdsa never generate the same key twice")
+	}
+
+	switch opts.KeyType {
+	case KeyEd25519:
+	case KeyRSA:
+		if opts.rsaBits() < minRSABits {
+			return fmt.Errorf("RSA keys must have at least %d bits", minRSABits)
+		}
+	case KeyECDSA:
+		if keyType, _ := ecdsaNames(opts.ecdsaCurve()); keyType == "" {
+			return fmt.Errorf("SSH only supports ECDSA keys on the P-256, P-384 and P-521 curves")
+		}
+	default:
+		return fmt.Errorf("unknown key type %d", opts.KeyType)
+	}
+	return nil
+}
+
+// keyGenerator returns a function generating a single key pair of the type
+// opts describe, drawing its randomness from random
+func (opts Options) keyGenerator(random io.Reader) func() (crypto.Signer, error) {
+	switch opts.KeyType {
+	case KeyRSA:
+		bits := opts.rsaBits()
+		return func() (crypto.Signer, error) {
+			return rsa.GenerateKey(random, bits)
+		}
+	case KeyECDSA:
+		curve := opts.ecdsaCurve()
+		return func() (crypto.Signer, error) {
+			return ecdsa.GenerateKey(curve, random)
+		}
+	}
+	return func() (crypto.Signer, error) {
+		_, privKey, err := ed25519.GenerateKey(random)
+		return privKey, err
+	}
+}
@@ -0,0 +1,1392 @@
+package vanity
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The key body is standard base64, so these are the only characters that can
+// ever appear in it. Any '=' padding is never searched.
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// ScopeLine also covers the key type prefix, such as "ssh-ed25519 "
+const lineAlphabet = base64Alphabet + "- "
+
+// SHA256 fingerprints are "SHA256:" followed by the unpadded base64 encoding
+// of a 32-byte digest, which is 43 characters long.
+const (
+	fingerprintPrefix = "SHA256:"
+	fingerprintLen    = 43
+)
+
+// The last fingerprint character only carries the final four bits of the
+// digest, padded with two zero bits, so it can only take one of these values.
+const lastFingerprintChars = "AEIMQUYcgkosw048"
+
+// Field selects which representation of the public key targets are matched
+// against
+type Field int
+
+const (
+	FieldKey            Field = iota // the authorized_keys line
+	FieldFingerprint                 // the SHA256 fingerprint, without "SHA256:"
+	FieldMD5Fingerprint              // the legacy MD5 fingerprint, as bare hex
+	FieldBubbleBabble                // the Bubble Babble digest shown by ssh-keygen -B
+	FieldHex                         // the raw ed25519 public key, as lowercase hex
+)
+
+// Legacy MD5 fingerprints are 16 bytes of lowercase hex separated by colons.
+// Targets are matched against the 32 hex digits alone, so both "deadbeef" and
+// "de:ad:be:ef" find the same keys.
+const (
+	md5HexLen   = 32
+	hexAlphabet = "0123456789abcdef"
+)
+
+// FieldHex searches the 32 bytes of an ed25519 public key as 64 hex digits,
+// the form some tools and trust-on-first-use databases store keys in
+const publicKeyHexLen = 2 * ed25519.PublicKeySize
+
+// Mode controls where in the public key a target may appear. With
+// FieldFingerprint the anchored modes refer to the start and end of the
+// fingerprint instead of the key body.
+type Mode int
+
+const (
+	ModeAnywhere Mode = iota // anywhere within the Scope
+	ModePrefix               // right after the fixed base64 header
+	ModeSuffix               // at the end of the base64 body
+	ModeAt                   // Options.At characters after the fixed header
+	ModeEither               // as ModePrefix or as ModeSuffix, whichever holds
+)
+
+// Case overrides Options.CaseInsensitive for a single target
+type Case int
+
+const (
+	CaseDefault     Case = iota // follow Options.CaseInsensitive
+	CaseSensitive               // match in exact case
+	CaseInsensitive             // fold ASCII case
+)
+
+// String describes how the case of a target is compared
+func (c Case) String() string {
+	switch c {
+	case CaseSensitive:
+		return "case-sensitive"
+	case CaseInsensitive:
+		return "case-insensitive"
+	}
+	return "default case"
+}
+
+// IgnoresCase reports whether the i-th target is compared ignoring case, as
+// TargetCases, SmartCase and CaseInsensitive decide in that order
+func (opts Options) IgnoresCase(i int) bool {
+	if i < len(opts.TargetCases) {
+		switch opts.TargetCases[i] {
+		case CaseSensitive:
+			return false
+		case CaseInsensitive:
+			return true
+		}
+	}
+	if opts.SmartCase {
+		return !hasUpper(opts.Targets[i])
+	}
+	return opts.CaseInsensitive
+}
+
+// hasUpper reports whether target holds an uppercase letter, escaped or not
+func hasUpper(target string) bool {
+	for i := 0; i < len(target); i++ {
+		if target[i] >= 'A' && target[i] <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
+// mixedCase reports whether some targets ignore case and others do not
+func (opts Options) mixedCase() bool {
+	for i := range opts.Targets {
+		if opts.IgnoresCase(i) != opts.IgnoresCase(0) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchesKey reports whether opts require anything of the searched field
+// itself, leaving aside randomart, FingerprintTargets and FingerprintRegex
+func (opts Options) searchesKey() bool {
+	return len(opts.Targets) > 0 || opts.Run != nil || opts.Palindrome != 0 || opts.Pronounceable != 0 || len(opts.Charsets) > 0
+}
+
+// fingerprintOptions returns the search FingerprintTargets make of the SHA256
+// fingerprint, compared the way opts compare Targets
+func (opts Options) fingerprintOptions() Options {
+	return Options{
+		KeyType:         opts.KeyType,
+		Bits:            opts.Bits,
+		Curve:           opts.Curve,
+		Targets:         opts.FingerprintTargets,
+		Field:           FieldFingerprint,
+		CaseInsensitive: opts.CaseInsensitive,
+		SmartCase:       opts.SmartCase,
+		Regex:           opts.Regex,
+		RequireAll:      opts.RequireAll,
+		Confusables:     opts.Confusables,
+		MaxMismatch:     opts.MaxMismatch,
+		MaxGaps:         opts.MaxGaps,
+		Subsequence:     opts.Subsequence,
+		CaseBudget:      opts.CaseBudget,
+	}
+}
+
+// Scope controls how much of the authorized_keys line ModeAnywhere searches
+// with FieldKey
+type Scope int
+
+const (
+	ScopeVariable Scope = iota // the base64 body after the fixed header
+	ScopeBody                  // the whole base64 body
+	ScopeLine                  // the whole line, including the key type
+)
+
+// Match records where a target was found within the string its Field
+// searched: Result.AuthorizedKey for FieldKey, Result.Fingerprint for
+// FieldFingerprint, Result.MD5Fingerprint for FieldMD5Fingerprint,
+// Result.BubbleBabble for FieldBubbleBabble or Result.PublicKeyHex for
+// FieldHex
+type Match struct {
+	Target string
+	Field  Field
+	Mode   Mode // where the target matched: ModePrefix or ModeSuffix for ModeEither, Options.Mode otherwise
+	Start  int
+	End    int
+
+	// IgnoreCase is set when the target was compared ignoring case
+	IgnoreCase bool
+
+	// Mismatches lists the offsets into Target, leaving out the colons of an
+	// MD5 target, of characters that differ with Options.MaxMismatch
+	Mismatches []int
+
+	// CaseDeviations lists the offsets into Target of characters that match
+	// only in another case than typed, with Options.CaseBudget
+	CaseDeviations []int
+
+	// Positions lists the offset of each character of Target in the searched
+	// string, with Options.Subsequence
+	Positions []int
+
+	// Spans lists every occurrence of Target in the searched string,
+	// overlaps included, the first being Start and End. Regular expressions
+	// report non-overlapping matches, and anchored, fuzzy, squashed,
+	// subsequence and delimited targets only ever have the one.
+	Spans []Span
+}
+
+// Span is the start and end offset of an occurrence within the searched
+// string of a Match
+type Span struct {
+	Start, End int
+}
+
+// validateTarget reports why a literal target can never match opts
+func validateTarget(target string, opts Options, layout *keyLayout) error {
+	if target == "" {
+		return fmt.Errorf("target sequence cannot be empty")
+	}
+
+	alphabet := base64Alphabet
+	alphabetHint := "cannot appear in a base64 key (only A-Z, a-z, 0-9, + and / can, and = padding is never searched)"
+	if opts.Field == FieldKey && opts.Mode == ModeAnywhere && opts.Scope == ScopeLine {
+		alphabet = lineAlphabet
+	}
+	if opts.Field == FieldMD5Fingerprint {
+		alphabet = hexAlphabet
+		alphabetHint = "cannot appear in an MD5 fingerprint (only 0-9 and a-f can, with optional colons)"
+	}
+	if opts.Field == FieldHex {
+		alphabet = hexAlphabet
+		alphabetHint = "cannot appear in a hex public key (only 0-9 and a-f can)"
+	}
+	if opts.Field == FieldBubbleBabble {
+		alphabet = bubbleBabbleAlphabet
+		alphabetHint = "cannot appear in a Bubble Babble digest (only the vowels " + bubbleVowels + ", the consonants " + bubbleConsonants + " and - can)"
+	}
+
+	// A character is possible if anything it may stand for can appear
+	var equivalents *equivalenceTable
+	if opts.Confusables {
+		equivalents = newEquivalenceTable(opts.CaseInsensitive)
+	}
+	possible := func(set string, c byte) bool {
+		if equivalents != nil {
+			return equivalents.contains(set, c)
+		}
+		return containsByteFold(set, c, opts.CaseInsensitive)
+	}
+
+	atoms, err := parseTarget(target)
+	if err != nil {
+		return err
+	}
+
+	// An atom is possible if any character it stands for is
+	atomPossible := func(set string, a atom) bool {
+		members := a.members()
+		for i := 0; i < len(members); i++ {
+			if possible(set, members[i]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	literal := false
+	var impossible []string
+	for _, a := range atoms {
+		switch a.kind {
+		case atomChar:
+			literal = true
+			if !possible(alphabet, a.char) {
+				impossible = append(impossible, a.quote())
+			}
+		case atomClass:
+			literal = true
+			// Point at the offending part, since a class can hide it well
+			for _, item := range a.items {
+				if item.lo == item.hi && !possible(alphabet, item.lo) {
+					return fmt.Errorf("target sequence %q can never match: %q at position %d in the character class %s %s", target, item.lo, item.pos, a.text, alphabetHint)
+				}
+				if !atomPossible(alphabet, atom{kind: atomClass, items: []classItem{item}}) {
+					return fmt.Errorf("target sequence %q can never match: none of the range %c-%c at position %d %s", target, item.lo, item.hi, item.pos, strings.TrimPrefix(alphabetHint, "cannot "))
+				}
+			}
+		}
+	}
+	if !literal {
+		return fmt.Errorf("target sequence %q has no literal characters and would match any key", target)
+	}
+	// Padding is easy to copy along with the end of a key, but it follows
+	// the body and is never searched
+	if body := strings.TrimRight(target, "="); opts.Field == FieldKey && body != target && body != "" {
+		padding := "keys of this type are never padded"
+		if layout.padding > 0 {
+			padding = fmt.Sprintf("keys of this type always end in %q after the body", strings.Repeat("=", layout.padding))
+		}
+		return fmt.Errorf("target sequence %q ends with '=' padding, which is never searched (%s); a suffix match for %q already ends right before any padding", target, padding, body)
+	}
+	if len(impossible) > 0 {
+		// Targets taken from URL-safe base64 are off by two characters
+		if alphabet == base64Alphabet && strings.ContainsAny(target, "-_") {
+			alphabetHint += "; SSH keys use standard base64, where URL-safe base64's - and _ are written + and /"
+		}
+		return fmt.Errorf("target sequence %q can never match: %s %s", target, strings.Join(impossible, ", "), alphabetHint)
+	}
+
+	mode := opts.Mode
+	minLen := minTargetLen(atoms)
+
+	regionLen, regionName := anchoredRegion(opts.Field, layout)
+
+	if mode == ModeAnywhere && opts.Last > 0 && minLen > opts.Last {
+		return fmt.Errorf("target sequence %q is longer than the last %d characters it must appear in", target, opts.Last)
+	}
+
+	if mode == ModeSuffix {
+		if minLen > regionLen {
+			return fmt.Errorf("target sequence %q is longer than the %d-character %s", target, regionLen, regionName)
+		}
+
+		last := atoms[len(atoms)-1]
+		switch {
+		case last.kind == atomAny || last.kind == atomRun:
+		case opts.Field == FieldFingerprint && !atomPossible(lastFingerprintChars, last):
+			return fmt.Errorf("a fingerprint can never end with %s; the last character must be one of %s", last.quote(), lastFingerprintChars)
+		case opts.Field == FieldKey && !atomPossible(layout.lastChars, last):
+			return fmt.Errorf("a key body can never end with %s; the last character must be one of %s", last.quote(), layout.lastChars)
+		}
+	}
+
+	if mode == ModePrefix || mode == ModeAt {
+		at := 0
+		if mode == ModeAt {
+			at = opts.At
+		}
+
+		if at < 0 {
+			return fmt.Errorf("match position %d cannot be negative", at)
+		}
+		if at+minLen > regionLen {
+			return fmt.Errorf("target sequence %q at position %d would run past the end of the %d-character %s", target, at, regionLen, regionName)
+		}
+
+		first := atoms[0]
+		if opts.Field == FieldKey && at == 0 && (first.kind == atomChar || first.kind == atomClass) && !atomPossible(layout.firstChars, first) {
+			return fmt.Errorf("a key body can never start with %s after the fixed header; the first character must be one of %s", first.quote(), layout.firstChars)
+		}
+	}
+
+	// A subsequence may skip over the characters that do not fit
+	if opts.Field == FieldBubbleBabble && !opts.Subsequence {
+		return validateBubbleBabble(target, atoms, opts, atomPossible)
+	}
+
+	return nil
+}
+
+// anchoredRegion returns the length and a description of the region anchored
+// modes work within: the variable part of the key body or the fingerprint
+func anchoredRegion(field Field, layout *keyLayout) (int, string) {
+	switch field {
+	case FieldFingerprint:
+		return fingerprintLen, "fingerprint"
+	case FieldMD5Fingerprint:
+		return md5HexLen, "MD5 fingerprint (without colons)"
+	case FieldBubbleBabble:
+		return bubbleBabbleLen, "Bubble Babble digest"
+	case FieldHex:
+		return publicKeyHexLen, "hex public key"
+	}
+	return layout.variableLen(), "variable part of the key body"
+}
+
+// anywhereLen returns the number of characters ModeAnywhere searches
+func anywhereLen(opts Options, layout *keyLayout) int {
+	regionLen := layout.variableLen()
+	switch opts.Field {
+	case FieldFingerprint:
+		regionLen = fingerprintLen
+	case FieldMD5Fingerprint:
+		regionLen = md5HexLen
+	case FieldBubbleBabble:
+		regionLen = bubbleBabbleLen
+	case FieldHex:
+		regionLen = publicKeyHexLen
+	default:
+		switch opts.Scope {
+		case ScopeBody:
+			regionLen = layout.bodyLen
+		case ScopeLine:
+			regionLen = len(layout.typePrefix) + layout.bodyLen
+		}
+	}
+	if opts.Last > 0 {
+		regionLen = min(regionLen, opts.Last)
+	}
+	return regionLen
+}
+
+// containsByteFold reports whether set contains c, ignoring ASCII case when
+// foldCase is set
+func containsByteFold(set string, c byte, foldCase bool) bool {
+	if foldCase {
+		return strings.IndexByte(set, toLowerCase(c)) >= 0 || strings.IndexByte(set, toUpperCase(c)) >= 0
+	}
+	return strings.IndexByte(set, c) >= 0
+}
+
+// matcher describes what workers look for in each generated public key
+type matcher struct {
+	patterns         []string // targets as given in Options
+	targets          [][]byte // lowercased when caseInsensitive is set, canonical with equivalents
+	field            Field
+	layout           keyLayout
+	mode             Mode
+	caseInsensitive  bool
+	scope            Scope
+	requireAll       bool
+	at               int                   // window offset in the region; zero for ModePrefix
+	last             int                   // only search this many characters at the end of the region
+	rangeStart       int                   // where Options.Range begins in the region
+	rangeLen         int                   // how many start positions it holds; zero without a range
+	lengths          []int                 // per target, set with a range
+	minCount         int                   // occurrences required of a target; zero or one means once
+	equivalents      *equivalenceTable     // replaces caseInsensitive for Options.Confusables
+	globs            []*glob               // set for targets with wildcards, nil otherwise
+	fuzzy            []*fuzzy              // replace the exact comparisons for Options.MaxMismatch
+	squash           []*squash             // and for Options.MaxGaps
+	subsequence      []*subsequence        // and for Options.Subsequence
+	run              *runScanner           // replaces targets for Options.Run
+	palindrome       *palindromeScanner    // replaces targets for Options.Palindrome
+	ignoreCase       []bool                // per target, as Options.TargetCases resolves
+	pronounceable    *pronounceableScanner // replaces targets for Options.Pronounceable
+	partial          *partial              // scores near misses for Options.Best
+	excludes         [][]byte              // canonical through fold
+	fold             *equivalenceTable     // compares excludes
+	charsets         []charsetSpan         // regions restricted to a character class
+	art              []ArtCell             // cells the randomart must show
+	artTitle         string                // key description in the randomart frame
+	res              []*regexp.Regexp      // replace targets when set
+	ac               *automaton            // scans for all targets at once when set
+	lowerRegion      bool                  // lowercase the region once per key for case-insensitive targets
+	fingerprint      *matcher              // checks Options.FingerprintTargets once the key matches
+	fingerprintRegex *regexp.Regexp        // checks Options.FingerprintRegex after that
+	weights          []int                 // per target, set for Options.MinScore
+	minScore         int
+	topScore         *int64
+	delimited        bool       // only accept targets set off from their neighbours
+	blocklist        *blocklist // rejects matching keys showing a blocklisted word
+	avoid            *byteSet   // rejects matching keys showing an Options.Avoid character
+	words            *wordHunt  // replaces targets for Options.Words
+	either           *matcher   // tries ModeSuffix when ModePrefix fails, for ModeEither
+}
+
+// newMatcher validates opts and compiles its targets
+func newMatcher(opts Options) (*matcher, error) {
+	if !opts.searchesKey() && len(opts.Randomart) == 0 && len(opts.FingerprintTargets) == 0 && opts.FingerprintRegex == "" && len(opts.Words) == 0 {
+		return nil, fmt.Errorf("no target sequence given")
+	}
+	for _, cell := range opts.Randomart {
+		if err := validateArtCell(cell); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := opts.validateKey(); err != nil {
+		return nil, err
+	}
+	layout := opts.layout()
+
+	// A case budget compares ignoring case and then counts what differs
+	if opts.CaseBudget != 0 {
+		if err := validateCaseBudget(opts); err != nil {
+			return nil, err
+		}
+		opts.CaseInsensitive = true
+	}
+
+	if opts.Mode == ModeEither {
+		return newEitherMatcher(opts)
+	}
+
+	// Targets that agree on case are compiled as if Options.CaseInsensitive
+	// said so; only a mix of cases needs each target folded on its own.
+	// Excluded sequences always follow Options.CaseInsensitive.
+	if len(opts.TargetCases) > len(opts.Targets) {
+		return nil, fmt.Errorf("%d target cases given for %d target sequences", len(opts.TargetCases), len(opts.Targets))
+	}
+	if opts.SmartCase && opts.CaseInsensitive {
+		return nil, fmt.Errorf("smart case already ignores case for targets without uppercase letters; it cannot be combined with ignoring case for all of them")
+	}
+	global := opts
+	mixedCase := opts.mixedCase()
+	if len(opts.Targets) > 0 && !mixedCase {
+		opts.CaseInsensitive = opts.IgnoresCase(0)
+	}
+
+	for _, r := range opts.Charsets {
+		if err := validateCharsetRegion(r, opts, &layout); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.Charsets) > 1 && charsetProbability(opts, &layout) == 0 {
+		return nil, fmt.Errorf("the character class regions overlap where no character can satisfy them all")
+	}
+
+	// Before anything folds case or splits targets into bytes
+	for _, target := range opts.Targets {
+		if err := validateASCII("target sequence", target); err != nil {
+			return nil, err
+		}
+	}
+	for _, exclude := range opts.Exclude {
+		if err := validateASCII("excluded sequence", exclude); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Regex && opts.Confusables {
+		return nil, fmt.Errorf("confusable characters cannot be expanded in regular expressions; use character classes such as [0O] instead")
+	}
+
+	if opts.Last < 0 {
+		return nil, fmt.Errorf("the number of trailing characters to search cannot be negative")
+	}
+	if opts.Last > 0 && opts.Mode != ModeAnywhere {
+		return nil, fmt.Errorf("a trailing search window cannot be combined with a prefix, suffix or position anchor")
+	}
+
+	if opts.MinCount < 0 {
+		return nil, fmt.Errorf("the number of occurrences to require cannot be negative")
+	}
+	if opts.MinCount > 1 {
+		switch {
+		case opts.Mode != ModeAnywhere:
+			return nil, fmt.Errorf("a target anchored with a prefix, suffix or position can only occur once")
+		case opts.Regex:
+			return nil, fmt.Errorf("occurrences of regular expressions cannot be counted; repeat the pattern instead")
+		case opts.Run != nil:
+			return nil, fmt.Errorf("occurrences of a run cannot be counted")
+		case opts.Palindrome != 0:
+			return nil, fmt.Errorf("occurrences of a palindrome cannot be counted")
+		case opts.Pronounceable != 0:
+			return nil, fmt.Errorf("a pronounceable ending can only occur once")
+		}
+		for _, target := range opts.Targets {
+			if strings.IndexByte(target, wildcardRun) >= 0 {
+				return nil, fmt.Errorf("occurrences of target sequence %q cannot be counted since '*' lets them run together", target)
+			}
+		}
+	}
+
+	if opts.Regex && opts.Mode != ModeAnywhere {
+		return nil, fmt.Errorf("regular expressions cannot be anchored with a prefix or suffix mode; use ^ or $ in the pattern instead")
+	}
+
+	if opts.Run != nil {
+		if err := validateRun(*opts.Run, opts, &layout); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Palindrome != 0 {
+		if err := validatePalindrome(opts.Palindrome, opts, &layout); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Pronounceable != 0 {
+		if err := validatePronounceable(opts.Pronounceable, opts, &layout); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.MaxMismatch != 0 {
+		if err := validateFuzzy(opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MaxGaps != 0 {
+		if err := validateSquash(opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Subsequence {
+		if err := validateSubsequence(opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Range != nil {
+		if err := validateRange(opts, &layout); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateScore(opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Delimited {
+		if err := validateDelimited(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.Words) > 0 {
+		if err := validateWords(opts); err != nil {
+			return nil, err
+		}
+	} else if opts.Best != nil {
+		if err := validateBest(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, target := range opts.Targets {
+		if opts.Regex {
+			if target == "" {
+				return nil, fmt.Errorf("target sequence cannot be empty")
+			}
+			continue
+		}
+		if opts.Field == FieldMD5Fingerprint {
+			target = strings.ReplaceAll(target, ":", "")
+		}
+		targetOpts := opts
+		targetOpts.CaseInsensitive = opts.IgnoresCase(i)
+		if err := validateTarget(target, targetOpts, &layout); err != nil {
+			return nil, err
+		}
+	}
+
+	excludes, err := compileExcludes(global)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := newBlocklist(global)
+	if err != nil {
+		return nil, err
+	}
+	avoid, err := newAvoidSet(global, &layout)
+	if err != nil {
+		return nil, err
+	}
+
+	var fingerprint *matcher
+	var fingerprintRegex *regexp.Regexp
+	if opts.FingerprintRegex != "" {
+		if fingerprintRegex, err = regexp.Compile(opts.FingerprintRegex); err != nil {
+			return nil, fmt.Errorf("invalid fingerprint regular expression: %v", err)
+		}
+	}
+
+	if len(opts.FingerprintTargets) > 0 {
+		if opts.Field != FieldKey {
+			return nil, fmt.Errorf("fingerprint targets are searched on top of the key; they cannot be combined with searching another field")
+		}
+		if fingerprint, err = newMatcher(global.fingerprintOptions()); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &matcher{
+		patterns:         opts.Targets,
+		field:            opts.Field,
+		layout:           layout,
+		mode:             opts.Mode,
+		caseInsensitive:  opts.CaseInsensitive,
+		scope:            opts.Scope,
+		requireAll:       opts.RequireAll,
+		excludes:         excludes,
+		fold:             foldTable(global.CaseInsensitive, nil),
+		charsets:         compileCharsets(opts.Charsets, opts.Field, &layout),
+		art:              opts.Randomart,
+		artTitle:         opts.artTitle(),
+		fingerprint:      fingerprint,
+		fingerprintRegex: fingerprintRegex,
+		delimited:        opts.Delimited,
+		blocklist:        blocked,
+		avoid:            avoid,
+	}
+	if opts.Mode == ModeAt {
+		m.at = opts.At
+	}
+	if opts.Mode == ModeAnywhere {
+		m.last = opts.Last
+		m.minCount = opts.MinCount
+	}
+	if opts.Range != nil {
+		m.rangeStart, m.rangeLen = opts.Range.Start, opts.Range.End-opts.Range.Start
+	}
+	if opts.Confusables {
+		m.equivalents = newEquivalenceTable(opts.CaseInsensitive)
+		m.fold = newEquivalenceTable(global.CaseInsensitive)
+	}
+	for i := range opts.Targets {
+		m.ignoreCase = append(m.ignoreCase, opts.IgnoresCase(i))
+	}
+	if opts.MinScore > 0 {
+		for i := range opts.Targets {
+			m.weights = append(m.weights, opts.weight(i))
+		}
+		m.minScore = opts.MinScore
+		m.topScore = opts.TopScore
+	}
+
+	// A word hunt never completes a match; the worker only scores it
+	if len(opts.Words) > 0 {
+		if m.words, err = newWordHunt(opts, &layout); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	// A run stands in for the only target
+	if opts.Run != nil {
+		fold := foldTable(opts.CaseInsensitive, m.equivalents)
+		m.patterns = []string{opts.Run.String()}
+		m.run = &runScanner{char: fold[opts.Run.Char], length: opts.Run.Length, fold: fold}
+		return m, nil
+	}
+
+	// So does a palindrome
+	if opts.Palindrome != 0 {
+		m.patterns = []string{palindromeLabel(opts.Palindrome)}
+		m.palindrome = &palindromeScanner{length: opts.Palindrome, fold: foldTable(opts.CaseInsensitive, m.equivalents)}
+		return m, nil
+	}
+
+	// And so does a pronounceable ending
+	if opts.Pronounceable != 0 {
+		m.patterns = []string{pronounceableLabel(opts.Pronounceable)}
+		m.pronounceable = &pronounceableScanner{length: opts.Pronounceable}
+		return m, nil
+	}
+
+	// Targets with wildcards or case escapes are compared through a table
+	// folding case and equivalences alike; the others keep the faster
+	// specialised paths. So are all targets when their cases differ, each
+	// through its own table.
+	fold := foldTable(opts.CaseInsensitive, m.equivalents)
+
+	for i, pattern := range opts.Targets {
+		if opts.Field == FieldMD5Fingerprint && !opts.Regex {
+			pattern = strings.ReplaceAll(pattern, ":", "")
+		}
+
+		if mixedCase {
+			var equivalents *equivalenceTable
+			if opts.Confusables {
+				equivalents = newEquivalenceTable(m.ignoreCase[i])
+			}
+			fold = foldTable(m.ignoreCase[i], equivalents)
+		}
+
+		if !opts.Regex && (mixedCase || hasPatterns(pattern) || hasCaseEscapes(pattern) && (opts.CaseInsensitive || opts.Confusables)) {
+			if m.globs == nil {
+				m.globs = make([]*glob, len(opts.Targets))
+			}
+			atoms, _ := parseTarget(pattern)
+			m.globs[i] = newGlob(atoms, opts.Mode, fold)
+		}
+
+		if opts.Best != nil {
+			m.partial = newPartial(pattern, opts.Mode, m.at, fold)
+		}
+
+		if opts.MaxMismatch > 0 || opts.CaseBudget > 0 {
+			f := &fuzzy{target: fold.canonical(pattern), maxMismatch: opts.MaxMismatch, fold: fold}
+			if opts.CaseBudget > 0 {
+				f.raw, f.caseBudget = []byte(pattern), opts.CaseBudget
+			}
+			m.fuzzy = append(m.fuzzy, f)
+		}
+
+		if opts.MaxGaps > 0 {
+			m.squash = append(m.squash, &squash{target: fold.canonical(pattern), maxGaps: opts.MaxGaps, fold: fold})
+		}
+
+		if opts.Subsequence {
+			m.subsequence = append(m.subsequence, &subsequence{target: fold.canonical(pattern), fold: fold})
+		}
+
+		if opts.Range != nil {
+			atoms, _ := parseTarget(pattern)
+			m.lengths = append(m.lengths, minTargetLen(atoms))
+		}
+
+		if opts.Regex {
+			if m.ignoreCase[i] {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression: %v", err)
+			}
+			m.res = append(m.res, re)
+			continue
+		}
+
+		pattern = unescape(pattern)
+		if m.equivalents != nil {
+			m.targets = append(m.targets, m.equivalents.canonical(pattern))
+		} else if opts.CaseInsensitive {
+			m.targets = append(m.targets, lowerASCII(pattern))
+		} else {
+			m.targets = append(m.targets, []byte(pattern))
+		}
+	}
+
+	// A single automaton pass beats scanning for each target in turn once
+	// there is more than one of them, and is essential for large wordlists
+	// and number ranges. Anchored targets walk it from the anchor, and
+	// suffixes are read backwards against reversed targets.
+	if !opts.Regex && !opts.RequireAll && m.minCount <= 1 && m.globs == nil && m.fuzzy == nil && m.squash == nil && m.subsequence == nil && m.weights == nil && opts.Range == nil && !opts.Delimited && len(opts.Targets) > 1 {
+		targets := m.targets
+		if opts.Mode == ModeSuffix {
+			targets = make([][]byte, len(m.targets))
+			for i, target := range m.targets {
+				targets[i] = slices.Clone(target)
+				slices.Reverse(targets[i])
+			}
+		}
+		if m.equivalents != nil {
+			m.ac = newAutomaton(targets, false)
+			m.ac.alias(m.equivalents)
+		} else {
+			m.ac = newAutomaton(targets, opts.CaseInsensitive)
+		}
+	}
+
+	m.lowerRegion = opts.CaseInsensitive && !mixedCase && m.equivalents == nil && !opts.Regex && opts.Mode == ModeAnywhere && m.ac == nil && m.fuzzy == nil && m.squash == nil && m.subsequence == nil && !opts.Delimited
+
+	return m, nil
+}
+
+// region returns the part of subject that targets are matched against, along
+// with its offset within subject. The subject is the authorized_keys line for
+// FieldKey, the full "SHA256:..." string for FieldFingerprint, the bare hex
+// digest for FieldMD5Fingerprint, the whole digest for FieldBubbleBabble and
+// the bare hex key for FieldHex.
+func (m *matcher) region(subject []byte) ([]byte, int) {
+	region, shift := m.fullRegion(subject)
+	if m.rangeLen > 0 {
+		// Matches may run past the end of the range, so each target cuts the
+		// region for itself
+		return region[m.rangeStart:], shift + m.rangeStart
+	}
+	if m.last == 0 {
+		return region, shift
+	}
+
+	// Only the tail of the region counts, measured from the end of the key
+	// body rather than the padding and newline that end the line
+	end := len(region)
+	if m.field == FieldKey && m.scope == ScopeLine {
+		end = len(m.layout.typePrefix) + m.layout.bodyLen
+	}
+	start := max(end-m.last, 0)
+	return region[start:end], shift + start
+}
+
+// fullRegion returns the region before Options.Last or Options.Range is
+// applied
+func (m *matcher) fullRegion(subject []byte) ([]byte, int) {
+	// Anchors always refer to the variable part of the key body
+	scope := m.scope
+	if m.mode != ModeAnywhere {
+		scope = ScopeVariable
+	}
+	return m.scopeRegion(subject, scope)
+}
+
+// scopeRegion returns the part of subject within scope, which only narrows
+// FieldKey subjects
+func (m *matcher) scopeRegion(subject []byte, scope Scope) ([]byte, int) {
+	switch m.field {
+	case FieldFingerprint:
+		return subject[len(fingerprintPrefix):], len(fingerprintPrefix)
+	case FieldMD5Fingerprint, FieldBubbleBabble, FieldHex:
+		return subject, 0
+	}
+
+	switch scope {
+	case ScopeLine:
+		return subject, 0
+	case ScopeBody:
+		return m.layout.body(subject), len(m.layout.typePrefix)
+	default:
+		return m.layout.body(subject)[len(m.layout.header):], len(m.layout.typePrefix) + len(m.layout.header)
+	}
+}
+
+// match checks a subject for any of the targets and returns the index of the
+// first one found. With requireAll set every target must be present and the
+// index is always -1. The scratch buffer belongs to the calling worker and
+// holds the lowercased region of case-insensitive searches.
+func (m *matcher) match(subject []byte, scratch *[]byte) (int, bool) {
+	// Checking a few fixed positions is cheaper than any search
+	if m.charsets != nil && !m.inCharsets(subject) {
+		return -1, false
+	}
+
+	if m.words != nil {
+		return -1, false
+	}
+
+	// Only the randomart or character classes constrain the key
+	if len(m.patterns) == 0 {
+		return -1, true
+	}
+
+	if index, ok := m.matchRegion(subject, scratch); ok || m.either == nil {
+		return index, ok
+	}
+	return m.either.matchRegion(subject, scratch)
+}
+
+// matchRegion checks the targets alone against the region of subject, with
+// the same results as match
+func (m *matcher) matchRegion(subject []byte, scratch *[]byte) (int, bool) {
+	region, _ := m.region(subject)
+	lowered := m.lower(region, scratch)
+
+	if m.weights != nil {
+		// Every target counts towards the score, so all are checked
+		score := m.score(region, lowered)
+		m.offerScore(score)
+		return -1, score >= m.minScore
+	}
+
+	if m.requireAll {
+		// Stop at the first missing target; most candidates fail right away
+		for i := range m.patterns {
+			if !m.matchTarget(region, lowered, i) {
+				return -1, false
+			}
+		}
+		return -1, true
+	}
+
+	if m.ac != nil {
+		var index int
+		switch m.mode {
+		case ModeAnywhere:
+			index, _ = m.ac.find(region)
+		case ModeSuffix:
+			index = m.ac.anchored(region, true)
+		default:
+			index = m.ac.anchored(region[min(m.at, len(region)):], false)
+		}
+		return index, index >= 0
+	}
+
+	for i := range m.patterns {
+		if m.matchTarget(region, lowered, i) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// lower returns region lowercased into scratch when lowerRegion is set, and
+// region itself otherwise. Folding every byte at every offset costs more than
+// folding the region once and searching that.
+func (m *matcher) lower(region []byte, scratch *[]byte) []byte {
+	if !m.lowerRegion {
+		return region
+	}
+	*scratch = append((*scratch)[:0], region...)
+	for j, c := range *scratch {
+		(*scratch)[j] = toLowerCase(c)
+	}
+	return *scratch
+}
+
+// excluded reports whether subject contains any excluded sequence anywhere
+// within the Scope, whatever the mode
+func (m *matcher) excluded(subject []byte) bool {
+	region, _ := m.scopeRegion(subject, m.scope)
+	for _, exclude := range m.excludes {
+		if m.fold.index(region, exclude) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compileExcludes validates the excluded sequences of opts and returns them
+// canonical through the same folding as the targets
+func compileExcludes(opts Options) ([][]byte, error) {
+	fold := foldTable(opts.CaseInsensitive, nil)
+	if opts.Confusables {
+		fold = newEquivalenceTable(opts.CaseInsensitive)
+	}
+
+	var excludes [][]byte
+	for _, exclude := range opts.Exclude {
+		if opts.Field == FieldMD5Fingerprint {
+			exclude = strings.ReplaceAll(exclude, ":", "")
+		}
+		if exclude == "" {
+			return nil, fmt.Errorf("excluded sequence cannot be empty")
+		}
+		canonical := fold.canonical(exclude)
+
+		// A literal target holding an excluded sequence could never be
+		// accepted
+		for _, target := range opts.Targets {
+			if opts.Regex || hasPatterns(target) {
+				continue
+			}
+			if opts.Field == FieldMD5Fingerprint {
+				target = strings.ReplaceAll(target, ":", "")
+			}
+			if fold.index([]byte(unescape(target)), canonical) >= 0 {
+				return nil, fmt.Errorf("target sequence %q contains the excluded sequence %q", target, exclude)
+			}
+		}
+		excludes = append(excludes, canonical)
+	}
+	return excludes, nil
+}
+
+// matchTarget checks a region for the i-th target. Lowered holds the region
+// lowercased when lowerRegion is set, and the region itself otherwise.
+func (m *matcher) matchTarget(region, lowered []byte, i int) bool {
+	region, lowered = m.within(region, i), m.within(lowered, i)
+	if m.delimited {
+		_, _, ok := m.findDelimited(region, lowered, i)
+		return ok
+	}
+	return m.matchUndelimited(region, lowered, i)
+}
+
+// matchUndelimited checks a region for the i-th target, whatever its
+// neighbours
+func (m *matcher) matchUndelimited(region, lowered []byte, i int) bool {
+	if m.run != nil {
+		_, _, ok := m.run.find(region)
+		return ok
+	}
+	if m.palindrome != nil {
+		_, _, ok := m.palindrome.find(region)
+		return ok
+	}
+	if m.pronounceable != nil {
+		_, _, ok := m.pronounceable.find(region)
+		return ok
+	}
+	if m.fuzzy != nil {
+		_, _, ok := m.fuzzy[i].find(region, m.mode, m.at)
+		return ok
+	}
+	if m.squash != nil {
+		_, _, ok := m.squash[i].find(region, m.mode, m.at)
+		return ok
+	}
+	if m.subsequence != nil {
+		_, _, ok := m.subsequence[i].find(region)
+		return ok
+	}
+	if m.minCount > 1 {
+		return m.count(region, i) >= m.minCount
+	}
+	if m.globs != nil && m.globs[i] != nil {
+		_, _, ok := m.globs[i].find(region, m.mode, m.at)
+		return ok
+	}
+
+	if m.mode == ModeAnywhere {
+		if m.res != nil {
+			return m.res[i].Match(region)
+		}
+		if m.equivalents != nil {
+			return m.equivalents.index(region, m.targets[i]) >= 0
+		}
+		if m.lowerRegion {
+			return containsBytes(lowered, m.targets[i])
+		}
+		if m.caseInsensitive {
+			return containsBytesIgnoreCase(region, m.targets[i])
+		}
+		return containsBytes(region, m.targets[i])
+	}
+
+	target := m.targets[i]
+
+	var window []byte
+	if m.mode == ModeSuffix {
+		if len(region) < len(target) {
+			return false
+		}
+		window = region[len(region)-len(target):]
+	} else {
+		if len(region) < m.at+len(target) {
+			return false
+		}
+		window = region[m.at : m.at+len(target)]
+	}
+
+	if m.equivalents != nil {
+		return m.equivalents.equal(window, target)
+	}
+	if m.caseInsensitive {
+		return equalBytesIgnoreCase(window, target)
+	}
+	return equalBytes(window, target)
+}
+
+// count returns how many times the i-th target occurs in region, overlaps
+// included, stopping once minCount are found
+func (m *matcher) count(region []byte, i int) int {
+	index := func(haystack []byte) int {
+		switch {
+		case m.globs != nil && m.globs[i] != nil:
+			return m.globs[i].index(haystack, 0, 0)
+		case m.equivalents != nil:
+			return m.equivalents.index(haystack, m.targets[i])
+		case m.caseInsensitive:
+			return indexBytesIgnoreCase(haystack, m.targets[i])
+		}
+		return indexBytes(haystack, m.targets[i])
+	}
+
+	n := 0
+	for n < m.minCount {
+		at := index(region)
+		if at < 0 {
+			break
+		}
+		n++
+		// The next occurrence may overlap this one
+		region = region[at+1:]
+	}
+	return n
+}
+
+// matches locates the targets reported by match: just the given index, every
+// target when requireAll is set, or every target present when scoring
+func (m *matcher) matches(subject []byte, index int) []Match {
+	if m.either != nil {
+		if _, ok := m.matchRegion(subject, new([]byte)); !ok {
+			return m.either.matches(subject, index)
+		}
+	}
+
+	var region, lowered []byte
+	if m.weights != nil {
+		region, _ = m.region(subject)
+		lowered = m.lower(region, new([]byte))
+	}
+
+	var found []Match
+	for i, pattern := range m.patterns {
+		if i == index || m.requireAll || m.weights != nil && m.matchTarget(region, lowered, i) {
+			start, end := m.locate(subject, i)
+			match := m.newMatch(pattern, start, end)
+			for _, span := range m.spans(subject, i, start, end) {
+				span.Start, span.End = m.offsets(span.Start, span.End)
+				match.Spans = append(match.Spans, span)
+			}
+			if i < len(m.ignoreCase) {
+				match.IgnoreCase = m.ignoreCase[i]
+			} else {
+				match.IgnoreCase = m.caseInsensitive
+			}
+			if m.subsequence != nil {
+				region, shift := m.region(subject)
+				for _, p := range m.subsequence[i].positions(region) {
+					p, _ = m.offsets(shift+p, shift+p+1)
+					match.Positions = append(match.Positions, p)
+				}
+			}
+			if m.fuzzy != nil {
+				match.Mismatches = m.fuzzy[i].mismatched(subject[start:end])
+				match.CaseDeviations = m.fuzzy[i].deviated(subject[start:end])
+			}
+			found = append(found, match)
+		}
+	}
+	return found
+}
+
+// newMatch records pattern found between the given subject offsets, which
+// refer to the searched string of Match
+func (m *matcher) newMatch(pattern string, start, end int) Match {
+	start, end = m.offsets(start, end)
+	return Match{Target: pattern, Field: m.field, Mode: m.mode, Start: start, End: end}
+}
+
+// offsets maps subject offsets onto the searched string of Match
+func (m *matcher) offsets(start, end int) (int, int) {
+	if m.field == FieldMD5Fingerprint {
+		// Map hex digit offsets onto the colon-separated form, which has a
+		// colon after every second digit
+		return start + start/2, end + (end-1)/2
+	}
+	return start, end
+}
+
+// spans returns the subject offsets of every occurrence of the i-th target,
+// the first of them being the one locate found between start and end
+func (m *matcher) spans(subject []byte, i, start, end int) []Span {
+	spans := []Span{{start, end}}
+	if m.mode != ModeAnywhere || m.delimited || m.fuzzy != nil || m.squash != nil || m.subsequence != nil || m.run != nil || m.palindrome != nil || m.pronounceable != nil {
+		return spans
+	}
+
+	region, shift := m.region(subject)
+	region = m.within(region, i)
+	if m.res != nil {
+		spans = spans[:0]
+		for _, loc := range m.res[i].FindAllIndex(region, -1) {
+			spans = append(spans, Span{shift + loc[0], shift + loc[1]})
+		}
+		return spans
+	}
+
+	// The next occurrence may overlap the last one
+	for from := start - shift + 1; from < len(region); {
+		at, length := -1, len(m.targets[i])
+		switch {
+		case m.globs != nil && m.globs[i] != nil:
+			if s, e, ok := m.globs[i].find(region[from:], ModeAnywhere, 0); ok {
+				at, length = s, e-s
+			}
+		case m.equivalents != nil:
+			at = m.equivalents.index(region[from:], m.targets[i])
+		case m.caseInsensitive:
+			at = indexBytesIgnoreCase(region[from:], m.targets[i])
+		default:
+			at = indexBytes(region[from:], m.targets[i])
+		}
+		if at < 0 {
+			break
+		}
+		spans = append(spans, Span{shift + from + at, shift + from + at + length})
+		from += at + 1
+	}
+	return spans
+}
+
+// locate returns the start and end offsets within subject of the i-th target,
+// which must already be known to match
+func (m *matcher) locate(subject []byte, i int) (int, int) {
+	// Offsets within the region are shifted back onto the subject
+	region, shift := m.region(subject)
+	region = m.within(region, i)
+
+	if m.delimited {
+		start, end, _ := m.findDelimited(region, region, i)
+		return shift + start, shift + end
+	}
+
+	if m.run != nil {
+		start, end, _ := m.run.find(region)
+		return shift + start, shift + end
+	}
+	if m.palindrome != nil {
+		start, end, _ := m.palindrome.find(region)
+		return shift + start, shift + end
+	}
+	if m.pronounceable != nil {
+		start, end, _ := m.pronounceable.find(region)
+		return shift + start, shift + end
+	}
+	if m.globs != nil && m.globs[i] != nil {
+		start, end, _ := m.globs[i].find(region, m.mode, m.at)
+		return shift + start, shift + end
+	}
+	if m.fuzzy != nil {
+		start, end, _ := m.fuzzy[i].find(region, m.mode, m.at)
+		return shift + start, shift + end
+	}
+	if m.squash != nil {
+		start, end, _ := m.squash[i].find(region, m.mode, m.at)
+		return shift + start, shift + end
+	}
+	if m.subsequence != nil {
+		start, end, _ := m.subsequence[i].find(region)
+		return shift + start, shift + end
+	}
+
+	switch m.mode {
+	case ModePrefix, ModeAt:
+		start := shift + m.at
+		return start, start + len(m.targets[i])
+	case ModeSuffix:
+		end := shift + len(region)
+		return end - len(m.targets[i]), end
+	}
+
+	if m.res != nil {
+		loc := m.res[i].FindIndex(region)
+		return shift + loc[0], shift + loc[1]
+	}
+
+	var start int
+	if m.equivalents != nil {
+		start = m.equivalents.index(region, m.targets[i])
+	} else if m.caseInsensitive {
+		start = indexBytesIgnoreCase(region, m.targets[i])
+	} else {
+		start = indexBytes(region, m.targets[i])
+	}
+	return shift + start, shift + start + len(m.targets[i])
+}
+
+// containsBytes reports whether needle occurs in haystack
+func containsBytes(haystack, needle []byte) bool {
+	return bytes.Contains(haystack, needle)
+}
+
+// Fast case-insensitive byte slice contains check
+func containsBytesIgnoreCase(haystack, needle []byte) bool {
+	return indexBytesIgnoreCase(haystack, needle) >= 0
+}
+
+// indexBytes returns the first offset of needle in haystack or -1. The
+// standard library search beats a byte-by-byte loop several times over even
+// on a line as short as a key.
+func indexBytes(haystack, needle []byte) int {
+	return bytes.Index(haystack, needle)
+}
+
+// Fast case-insensitive byte slice search; needle must already be lowercase
+func indexBytesIgnoreCase(haystack, needle []byte) int {
+	if len(needle) == 0 {
+		return 0
+	}
+	if len(needle) > len(haystack) {
+		return -1
+	}
+
+	for i := 0; i <= len(haystack)-len(needle); i++ {
+		found := true
+		for j := 0; j < len(needle); j++ {
+			// Convert both bytes to lowercase for comparison
+			haystackChar := toLowerCase(haystack[i+j])
+			needleChar := needle[j] // Already converted to lowercase in worker
+			if haystackChar != needleChar {
+				found = false
+				break
+			}
+		}
+		if found {
+			return i
+		}
+	}
+	return -1
+}
+
+// Fast case-sensitive byte slice equality check
+func equalBytes(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Fast case-insensitive byte slice equality check; b must already be lowercase
+func equalBytesIgnoreCase(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if toLowerCase(a[i]) != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lowerASCII folds s the way toLowerCase folds the haystack, leaving every
+// other byte alone. Unlike strings.ToLower it cannot turn a character that
+// slipped past validateASCII into something else, such as the Kelvin sign
+// into a 'k' that would then match.
+func lowerASCII(s string) []byte {
+	b := []byte(s)
+	for i, c := range b {
+		b[i] = toLowerCase(c)
+	}
+	return b
+}
+
+// Fast ASCII uppercase conversion
+func toUpperCase(b byte) byte {
+	if b >= 'a' && b <= 'z' {
+		return b - ('a' - 'A')
+	}
+	return b
+}
+
+// Fast ASCII lowercase conversion
+func toLowerCase(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + ('a' - 'A')
+	}
+	return b
+}
@@ -0,0 +1,222 @@
+package vanity
+
+import (
+	"strings"
+	"testing"
+)
+
+// keyLine builds the authorized_keys line of a key laid out as opts would
+// generate it, whose variable part ends with tail and is filled with 'x'
+// before it
+func keyLine(t *testing.T, opts Options, tail string) []byte {
+	t.Helper()
+	layout := opts.layout()
+	if len(tail) > layout.variableLen() {
+		t.Fatalf("tail %q is longer than the %d-character variable part", tail, layout.variableLen())
+	}
+	fill := strings.Repeat("x", layout.variableLen()-len(tail))
+	return []byte(layout.typePrefix + layout.header + fill + tail + strings.Repeat("=", layout.padding) + "\n")
+}
+
+func TestSuffixMatch(t *testing.T) {
+	rsa := Options{KeyType: KeyRSA}
+	rsaLast := string(rsa.layout().lastChars[0])
+
+	for _, tc := range []struct {
+		name   string
+		opts   Options
+		target string
+		tail   string
+		want   bool
+	}{
+		{"ends with the target", Options{}, "abc", "abc", true},
+		{"target one character before the end", Options{}, "abc", "abcd", false},
+		{"target at the start of the variable part", Options{}, "abc", "abc" + strings.Repeat("d", 40), false},
+		{"padded key ending with the target", rsa, "ab" + rsaLast, "ab" + rsaLast, true},
+		{"padded key with the target one character before the end", rsa, "ab" + rsaLast, "ab" + rsaLast + "d", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.Targets = []string{tc.target}
+			opts.Mode = ModeSuffix
+			m, err := newMatcher(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			line := keyLine(t, opts, tc.tail)
+			if _, got := m.match(line, new([]byte)); got != tc.want {
+				t.Errorf("match(%q) = %v, want %v", line, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSuffixRejectsPadding(t *testing.T) {
+	for _, opts := range []Options{{}, {KeyType: KeyRSA}} {
+		opts.Targets = []string{"abc="}
+		opts.Mode = ModeSuffix
+		_, err := newMatcher(opts)
+		if err == nil || !strings.Contains(err.Error(), "padding") {
+			t.Errorf("key type %v: newMatcher(%q) error = %v, want one about padding", opts.KeyType, opts.Targets[0], err)
+		}
+	}
+}
+
+func TestScopeSkipsFixedText(t *testing.T) {
+	line := keyLine(t, Options{}, "")
+	for _, target := range []string{"ssh", "ed2", "AAAA"} {
+		t.Run(target, func(t *testing.T) {
+			for _, tc := range []struct {
+				scope Scope
+				want  bool
+			}{
+				{ScopeVariable, false},
+				{ScopeLine, true},
+			} {
+				m, err := newMatcher(Options{Targets: []string{target}, Scope: tc.scope})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, got := m.match(line, new([]byte)); got != tc.want {
+					t.Errorf("scope %v: match(%q) = %v, want %v", tc.scope, line, got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestScopeVariableMatches(t *testing.T) {
+	m, err := newMatcher(Options{Targets: []string{"yegor"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tail := range []string{"yegor", "yegor" + strings.Repeat("d", 38), "dyegord"} {
+		line := keyLine(t, Options{}, tail)
+		if _, ok := m.match(line, new([]byte)); !ok {
+			t.Errorf("match(%q) = false, want true", line)
+		}
+	}
+}
+
+func TestSmartCase(t *testing.T) {
+	opts := Options{SmartCase: true, Targets: []string{"abc", "123", "aBc", "a1b", "ABC"}}
+	for i, want := range []bool{true, true, false, true, false} {
+		if got := opts.IgnoresCase(i); got != want {
+			t.Errorf("IgnoresCase(%q) = %v, want %v", opts.Targets[i], got, want)
+		}
+	}
+
+	// A cs: or ci: prefix on --target overrides the guess
+	opts.TargetCases = []Case{CaseSensitive, CaseDefault, CaseInsensitive}
+	for i, want := range []bool{false, true, true, true, false} {
+		if got := opts.IgnoresCase(i); got != want {
+			t.Errorf("with target cases, IgnoresCase(%q) = %v, want %v", opts.Targets[i], got, want)
+		}
+	}
+}
+
+func TestSmartCaseMatch(t *testing.T) {
+	for _, tc := range []struct {
+		target, tail string
+		want         bool
+	}{
+		{"abc", "ABC", true},
+		{"abc", "aBc", true},
+		{"aBc", "aBc", true},
+		{"aBc", "abc", false},
+		{"aBc", "ABC", false},
+	} {
+		m, err := newMatcher(Options{SmartCase: true, Targets: []string{tc.target}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := keyLine(t, Options{}, tc.tail)
+		if _, got := m.match(line, new([]byte)); got != tc.want {
+			t.Errorf("%q in %q: match = %v, want %v", tc.target, line, got, tc.want)
+		}
+	}
+
+	if _, err := newMatcher(Options{SmartCase: true, CaseInsensitive: true, Targets: []string{"abc"}}); err == nil {
+		t.Errorf("newMatcher accepted SmartCase with CaseInsensitive")
+	}
+}
+
+// indexBytesLoop is the byte-by-byte search containsBytes used before it
+// delegated to bytes.Contains, kept to measure one against the other
+func indexBytesLoop(haystack, needle []byte) int {
+	if len(needle) == 0 {
+		return 0
+	}
+	if len(needle) > len(haystack) {
+		return -1
+	}
+
+	for i := 0; i <= len(haystack)-len(needle); i++ {
+		found := true
+		for j := 0; j < len(needle); j++ {
+			if haystack[i+j] != needle[j] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return i
+		}
+	}
+	return -1
+}
+
+func BenchmarkContainsBytes(b *testing.B) {
+	// The base64 body of an ed25519 key, searched for a target it lacks as
+	// almost every candidate does
+	haystack := []byte(strings.Fields(goldenKey)[1])
+	if len(haystack) != 68 {
+		b.Fatalf("haystack is %d bytes, want 68", len(haystack))
+	}
+	needle := []byte("yegor")
+
+	b.Run("loop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if indexBytesLoop(haystack, needle) >= 0 {
+				b.Fatal("unexpected match")
+			}
+		}
+	})
+	b.Run("bytes.Contains", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if containsBytes(haystack, needle) {
+				b.Fatal("unexpected match")
+			}
+		}
+	})
+}
+
+func BenchmarkIgnoreCase(b *testing.B) {
+	haystack := []byte(strings.Fields(goldenKey)[1])
+	for _, target := range []string{"yegor", "yegors", "yegorsk"} {
+		needle := []byte(target)
+		m, err := newMatcher(Options{Targets: []string{target}, CaseInsensitive: true})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !m.lowerRegion {
+			b.Fatalf("%q does not lowercase the region", target)
+		}
+
+		b.Run(target+"/per-offset", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if containsBytesIgnoreCase(haystack, needle) {
+					b.Fatal("unexpected match")
+				}
+			}
+		})
+		b.Run(target+"/lowered-once", func(b *testing.B) {
+			var scratch []byte
+			for i := 0; i < b.N; i++ {
+				if containsBytes(m.lower(haystack, &scratch), needle) {
+					b.Fatal("unexpected match")
+				}
+			}
+		})
+	}
+}
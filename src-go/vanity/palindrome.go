@@ -0,0 +1,84 @@
+package vanity
+
+import (
+	"fmt"
+	"math"
+)
+
+// palindromeLabel describes a palindrome search in place of a target
+func palindromeLabel(length int) string {
+	return fmt.Sprintf("palindrome of at least %d characters", length)
+}
+
+// validatePalindrome reports why a search for palindromes of at least length
+// characters can never match opts
+func validatePalindrome(length int, opts Options, layout *keyLayout) error {
+	if length < 2 {
+		return fmt.Errorf("a palindrome must be at least two characters long")
+	}
+	if opts.Regex {
+		return fmt.Errorf("a palindrome cannot be combined with regular expressions")
+	}
+	if opts.Mode != ModeAnywhere {
+		return fmt.Errorf("a palindrome cannot be anchored with a prefix, suffix or position")
+	}
+	if len(opts.Targets) > 0 || opts.Run != nil {
+		return fmt.Errorf("a palindrome replaces the target sequences and runs; give only one of them")
+	}
+	if length > anywhereLen(opts, layout) {
+		return fmt.Errorf("a palindrome of %d characters cannot fit in the %d characters searched", length, anywhereLen(opts, layout))
+	}
+	return nil
+}
+
+// palindromeScanner finds palindromes, comparing characters through fold
+type palindromeScanner struct {
+	length int
+	fold   *equivalenceTable
+}
+
+// find returns the offsets of the first palindrome in region that is at
+// least length characters long, extended as far as it goes. Every centre is
+// expanded in turn, which is cheap at the length of a key.
+func (s *palindromeScanner) find(region []byte) (int, int, bool) {
+	// Centre 2i lies on character i, centre 2i+1 between i and i+1
+	for centre := 0; centre < 2*len(region)-1; centre++ {
+		lo, hi := centre/2, (centre+1)/2
+		for lo >= 0 && hi < len(region) && s.fold[region[lo]] == s.fold[region[hi]] {
+			lo--
+			hi++
+		}
+		if hi-lo-1 >= s.length {
+			return lo + 1, hi, true
+		}
+	}
+	return 0, 0, false
+}
+
+// palindromeProbability estimates the chance that a single key holds a
+// palindrome of at least length characters. Any such palindrome contains one
+// of exactly length or length+1 characters around the same centre, so only
+// windows of those two sizes need counting, and a window is a palindrome
+// when each of its mirrored pairs of characters is equivalent.
+func palindromeProbability(length int, opts Options, layout *keyLayout, same func(a, b byte) bool) float64 {
+	alphabet := base64Alphabet
+	switch opts.Field {
+	case FieldMD5Fingerprint, FieldHex:
+		alphabet = hexAlphabet
+	case FieldBubbleBabble:
+		alphabet = bubbleBabbleAlphabet
+	}
+
+	// The chance that two random characters are equivalent
+	pair := 0.0
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		p := fieldProbability(opts.Field, func(x byte) bool { return x == c })
+		pair += p * fieldProbability(opts.Field, func(x byte) bool { return same(x, c) })
+	}
+
+	regionLen := anywhereLen(opts, layout)
+	short := math.Pow(1-math.Pow(pair, float64(length/2)), float64(regionLen-length+1))
+	long := math.Pow(1-math.Pow(pair, float64((length+1)/2)), float64(max(regionLen-length, 0)))
+	return 1 - short*long
+}
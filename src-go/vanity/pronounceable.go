@@ -0,0 +1,136 @@
+package vanity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A pronounceable ending is a sequence of syllables, each a consonant, a
+// vowel and an optional closing consonant, as in "tabeko" or "rindal". Case
+// never matters, and digits, '+' and '/' break it.
+const vowels = "aeiou"
+
+// syllableState tracks how far a pronounceable ending has got. The syllable
+// grammar is small enough to run as a deterministic automaton.
+type syllableState int
+
+const (
+	syllableStart  syllableState = iota // nothing read yet
+	syllableOnset                       // a consonant that needs a vowel next
+	syllableVowel                       // a complete syllable ending in a vowel
+	syllableCoda                        // a complete syllable ending in a consonant, which may also start the next one
+	syllableBroken                      // no longer pronounceable
+)
+
+// accepting reports whether the characters read so far are pronounceable
+func (s syllableState) accepting() bool {
+	return s == syllableVowel || s == syllableCoda
+}
+
+// next returns the state after reading a vowel, a consonant or neither
+func (s syllableState) next(vowel, consonant bool) syllableState {
+	switch {
+	case consonant && (s == syllableStart || s == syllableCoda):
+		return syllableOnset
+	case consonant && s == syllableVowel:
+		return syllableCoda
+	case vowel && (s == syllableOnset || s == syllableCoda):
+		return syllableVowel
+	}
+	return syllableBroken
+}
+
+// isVowel and isConsonant classify ASCII letters, ignoring case
+func isVowel(c byte) bool {
+	return strings.IndexByte(vowels, toLowerCase(c)) >= 0
+}
+
+func isConsonant(c byte) bool {
+	c = toLowerCase(c)
+	return c >= 'a' && c <= 'z' && !isVowel(c)
+}
+
+// pronounceable reports whether s splits into syllables
+func pronounceable(s []byte) bool {
+	state := syllableStart
+	for _, c := range s {
+		state = state.next(isVowel(c), isConsonant(c))
+		if state == syllableBroken {
+			return false
+		}
+	}
+	return state.accepting()
+}
+
+// pronounceableLabel describes a pronounceable ending in place of a target
+func pronounceableLabel(length int) string {
+	return fmt.Sprintf("pronounceable ending of %d characters", length)
+}
+
+// validatePronounceable reports why an ending of length pronounceable
+// characters can never match opts
+func validatePronounceable(length int, opts Options, layout *keyLayout) error {
+	if length < 2 {
+		return fmt.Errorf("a pronounceable ending must be at least two characters long")
+	}
+	if opts.Regex {
+		return fmt.Errorf("a pronounceable ending cannot be combined with regular expressions")
+	}
+	if opts.Mode != ModeAnywhere {
+		return fmt.Errorf("a pronounceable ending is always at the end; it cannot be anchored with a prefix, suffix or position")
+	}
+	if opts.Field == FieldKey && opts.Scope == ScopeLine {
+		return fmt.Errorf("a pronounceable ending is checked at the end of the key body, not of the whole line")
+	}
+	if len(opts.Targets) > 0 || opts.Run != nil || opts.Palindrome != 0 {
+		return fmt.Errorf("a pronounceable ending replaces the target sequences, runs and palindromes; give only one of them")
+	}
+	if length > anywhereLen(opts, layout) {
+		return fmt.Errorf("a pronounceable ending of %d characters cannot fit in the %d characters searched", length, anywhereLen(opts, layout))
+	}
+	return nil
+}
+
+// pronounceableScanner checks the end of a region for a pronounceable ending
+type pronounceableScanner struct {
+	length int
+}
+
+// find returns the offsets of the last length characters of region when
+// they are pronounceable
+func (s *pronounceableScanner) find(region []byte) (int, int, bool) {
+	start := len(region) - s.length
+	if start < 0 || !pronounceable(region[start:]) {
+		return 0, 0, false
+	}
+	return start, len(region), true
+}
+
+// pronounceableProbability estimates the chance that a single key ends in a
+// pronounceable run of length characters, by following the chance of being
+// in each state of the syllable automaton from one position to the next
+func pronounceableProbability(length int, opts Options, layout *keyLayout) float64 {
+	regionLen, _ := anchoredRegion(opts.Field, layout)
+
+	var states [syllableBroken]float64
+	states[syllableStart] = 1
+	for i := regionLen - length; i < regionLen; i++ {
+		pVowel := positionProbability(opts.Field, layout, i, regionLen, isVowel)
+		pConsonant := positionProbability(opts.Field, layout, i, regionLen, isConsonant)
+
+		var next [syllableBroken]float64
+		for s, p := range states {
+			if p == 0 {
+				continue
+			}
+			if t := syllableState(s).next(true, false); t != syllableBroken {
+				next[t] += p * pVowel
+			}
+			if t := syllableState(s).next(false, true); t != syllableBroken {
+				next[t] += p * pConsonant
+			}
+		}
+		states = next
+	}
+	return states[syllableVowel] + states[syllableCoda]
+}
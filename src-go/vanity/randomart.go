@@ -0,0 +1,141 @@
+package vanity
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// The randomart field ssh-keygen -lv draws, as in OpenSSH's sshkey.c: a
+// bishop starts in the centre and walks diagonally, two bits of the SHA256
+// digest per step, and each cell shows how often it was visited.
+const (
+	artRows = 9
+	artCols = 17
+)
+
+// artSymbols are the characters for 0 to 14 visits, then the start and end
+// of the walk. Cells visited more often keep showing '^'.
+const artSymbols = " .o+=*BOX@%&#/^SE"
+
+const (
+	artStart = len(artSymbols) - 2
+	artEnd   = len(artSymbols) - 1
+)
+
+// ArtCell requires the randomart of a key to show Char at Row and Col, both
+// counted from zero at the top left of the field inside the frame
+type ArtCell struct {
+	Row  int
+	Col  int
+	Char byte
+}
+
+// String describes the cell for display
+func (c ArtCell) String() string {
+	return fmt.Sprintf("%q at row %d, column %d", c.Char, c.Row, c.Col)
+}
+
+// validateArtCell reports why c can never appear in a randomart field
+func validateArtCell(c ArtCell) error {
+	if c.Row < 0 || c.Row >= artRows || c.Col < 0 || c.Col >= artCols {
+		return fmt.Errorf("randomart cell %d:%d lies outside the %d-row, %d-column field", c.Row, c.Col, artRows, artCols)
+	}
+	symbol := strings.IndexByte(artSymbols, c.Char)
+	if symbol < 0 {
+		return fmt.Errorf("randomart never shows %q; only the characters %q can appear", c.Char, artSymbols)
+	}
+
+	// The walk always starts in the centre, which then shows S unless the
+	// walk also ends there
+	centre := c.Row == artRows/2 && c.Col == artCols/2
+	if centre && symbol != artStart && symbol != artEnd {
+		return fmt.Errorf("the centre of the randomart always shows S, or E when the walk ends there")
+	}
+	if !centre && symbol == artStart {
+		return fmt.Errorf("randomart only shows S in the centre, at row %d, column %d", artRows/2, artCols/2)
+	}
+	return nil
+}
+
+// artField holds the symbol index of every randomart cell
+type artField [artRows][artCols]byte
+
+// drawArt walks the bishop over the field for digest
+func drawArt(digest []byte) *artField {
+	var field artField
+	row, col := artRows/2, artCols/2
+	for _, b := range digest {
+		for step := 0; step < 4; step++ {
+			if b&1 != 0 {
+				col = min(col+1, artCols-1)
+			} else {
+				col = max(col-1, 0)
+			}
+			if b&2 != 0 {
+				row = min(row+1, artRows-1)
+			} else {
+				row = max(row-1, 0)
+			}
+			if int(field[row][col]) < artStart-1 {
+				field[row][col]++
+			}
+			b >>= 2
+		}
+	}
+	field[artRows/2][artCols/2] = byte(artStart)
+	field[row][col] = byte(artEnd)
+	return &field
+}
+
+// matches reports whether the field shows every cell
+func (f *artField) matches(cells []ArtCell) bool {
+	for _, c := range cells {
+		if artSymbols[f[c.Row][c.Col]] != c.Char {
+			return false
+		}
+	}
+	return true
+}
+
+// format frames the field as ssh-keygen -lv prints it, with title such as
+// "ED25519 256" centred in the top border
+func (f *artField) format(title string) string {
+	var b strings.Builder
+	border := func(label string) {
+		b.WriteByte('+')
+		pad := (artCols - len(label)) / 2
+		b.WriteString(strings.Repeat("-", pad))
+		b.WriteString(label)
+		b.WriteString(strings.Repeat("-", artCols-pad-len(label)))
+		b.WriteString("+\n")
+	}
+
+	border("[" + title + "]")
+	for _, row := range f {
+		b.WriteByte('|')
+		for _, symbol := range row {
+			b.WriteByte(artSymbols[symbol])
+		}
+		b.WriteString("|\n")
+	}
+	border("[SHA256]")
+	return b.String()
+}
+
+// artTitle returns the key description ssh-keygen puts in the top border
+func (opts Options) artTitle() string {
+	switch opts.KeyType {
+	case KeyRSA:
+		return fmt.Sprintf("RSA %d", opts.rsaBits())
+	case KeyECDSA:
+		return fmt.Sprintf("ECDSA %d", opts.ecdsaCurve().Params().BitSize)
+	}
+	return "ED25519 256"
+}
+
+// randomart draws the framed randomart of a key blob
+func randomart(blob []byte, title string) string {
+	sum := sha256.Sum256(blob)
+	return drawArt(sum[:]).format(title)
+}
@@ -0,0 +1,50 @@
+package vanity
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+// goldenArt is the randomart ssh-keygen -lv draws for goldenKey
+const goldenArt = `+--[ED25519 256]--+
+|     ..o=o..     |
+|  . . o..*+      |
+|   o +. =+.+     |
+|   oo= + o+ .    |
+|  o O O S .      |
+|   * ^ + .       |
+|    % B          |
+|   . = .         |
+|  E   .          |
++----[SHA256]-----+
+`
+
+func TestRandomartGolden(t *testing.T) {
+	if got := randomart(parseGoldenKey(t).Marshal(), "ED25519 256"); got != goldenArt {
+		t.Errorf("randomart =\n%s\nwant\n%s", got, goldenArt)
+	}
+}
+
+func TestRandomartCells(t *testing.T) {
+	sum := sha256.Sum256(parseGoldenKey(t).Marshal())
+	field := drawArt(sum[:])
+
+	for _, tc := range []struct {
+		name  string
+		cells []ArtCell
+		want  bool
+	}{
+		{"start in the centre", []ArtCell{{4, 8, 'S'}}, true},
+		{"end", []ArtCell{{8, 2, 'E'}}, true},
+		{"shown cells", []ArtCell{{0, 8, '='}, {5, 5, '^'}, {6, 4, '%'}}, true},
+		{"empty cell", []ArtCell{{0, 0, ' '}}, true},
+		{"cell not shown", []ArtCell{{0, 0, 'o'}}, false},
+		{"one of several not shown", []ArtCell{{0, 8, '='}, {5, 5, '*'}}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := field.matches(tc.cells); got != tc.want {
+				t.Errorf("matches(%v) = %v, want %v", tc.cells, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package vanity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Range limits where ModeAnywhere matches may start, as offsets from Start up
+// to but excluding End within the region anchored modes work in: the
+// variable part of the key body after its fixed header, or the digest. A
+// match starting in the range may run past its end.
+type Range struct {
+	Start, End int
+}
+
+// String formats r as the start:end the command line takes
+func (r Range) String() string {
+	return fmt.Sprintf("%d:%d", r.Start, r.End)
+}
+
+// validateRange reports why opts cannot limit its matches to opts.Range.
+// Each target must have a fixed length so that the region can be cut off
+// where it would start past the end.
+func validateRange(opts Options, layout *keyLayout) error {
+	r := *opts.Range
+	regionLen, regionName := anchoredRegion(opts.Field, layout)
+	switch {
+	case r.Start < 0:
+		return fmt.Errorf("range %s cannot start before the beginning of the %s", r, regionName)
+	case r.End <= r.Start:
+		return fmt.Errorf("range %s must end after it starts", r)
+	case r.End > regionLen:
+		return fmt.Errorf("range %s runs past the end of the %d-character %s", r, regionLen, regionName)
+	case opts.Mode != ModeAnywhere:
+		return fmt.Errorf("a range cannot be combined with a prefix, suffix or position anchor")
+	case opts.Field == FieldKey && opts.Scope != ScopeVariable:
+		return fmt.Errorf("a range is counted from the end of the fixed header and cannot be combined with a wider scope")
+	case opts.Last > 0:
+		return fmt.Errorf("a range cannot be combined with a trailing search window")
+	case opts.Regex:
+		return fmt.Errorf("regular expressions cannot be limited to a range; use ^ and a repeated . in the pattern instead")
+	case len(opts.Targets) == 0:
+		return fmt.Errorf("only target sequences can be limited to a range")
+	case opts.MinCount > 1:
+		return fmt.Errorf("occurrences cannot be counted within a range")
+	case opts.Delimited:
+		return fmt.Errorf("delimited matches cannot be limited to a range")
+	case opts.MaxGaps > 0:
+		return fmt.Errorf("matches skipping '+' and '/' cannot be limited to a range")
+	case opts.Subsequence:
+		return fmt.Errorf("a subsequence is spread over the whole field and cannot be limited to a range")
+	case opts.Best != nil:
+		return fmt.Errorf("a best-effort search cannot be limited to a range")
+	case len(opts.Words) > 0:
+		return fmt.Errorf("a word hunt cannot be limited to a range")
+	}
+
+	for _, target := range opts.Targets {
+		if strings.IndexByte(target, wildcardRun) >= 0 {
+			return fmt.Errorf("target sequence %q may be of any length with '*', so where it starts cannot be limited to a range", target)
+		}
+		if opts.Field == FieldMD5Fingerprint {
+			target = strings.ReplaceAll(target, ":", "")
+		}
+		atoms, _ := parseTarget(target)
+		if r.Start+minTargetLen(atoms) > regionLen {
+			return fmt.Errorf("target sequence %q starting at %d would run past the end of the %d-character %s", target, r.Start, regionLen, regionName)
+		}
+	}
+	return nil
+}
+
+// rangePositions returns how many start positions are left to a target of
+// length n within r, in a region of regionLen characters
+func rangePositions(r Range, n, regionLen int) int {
+	return min(r.End, regionLen-n+1) - r.Start
+}
+
+// within cuts region, which begins at the start of Options.Range, so that
+// the i-th target can only be found starting inside the range
+func (m *matcher) within(region []byte, i int) []byte {
+	if m.rangeLen == 0 {
+		return region
+	}
+	return region[:min(len(region), m.rangeLen+m.lengths[i]-1)]
+}
@@ -0,0 +1,73 @@
+package vanity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Run describes a run of one character repeated Length times, such as
+// "zzzzzzz"
+type Run struct {
+	Char   byte // the repeated character, or zero for any character
+	Length int
+}
+
+// String describes the run for display
+func (r Run) String() string {
+	if r.Char == 0 {
+		return fmt.Sprintf("any character repeated %d times", r.Length)
+	}
+	return fmt.Sprintf("%q repeated %d times", r.Char, r.Length)
+}
+
+// validateRun reports why r can never match opts. The run must fit in the
+// region like any other target, and a specific character must be possible.
+func validateRun(r Run, opts Options, layout *keyLayout) error {
+	if r.Length < 1 {
+		return fmt.Errorf("a run must be at least one character long")
+	}
+	if opts.Regex {
+		return fmt.Errorf("a run of repeated characters cannot be combined with regular expressions")
+	}
+	if opts.Mode != ModeAnywhere {
+		return fmt.Errorf("a run of repeated characters cannot be anchored with a prefix, suffix or position")
+	}
+	if len(opts.Targets) > 0 {
+		return fmt.Errorf("a run of repeated characters replaces the target sequences; give one or the other")
+	}
+
+	if r.Length > anywhereLen(opts, layout) {
+		return fmt.Errorf("a run of %d characters cannot fit in the %d characters searched", r.Length, anywhereLen(opts, layout))
+	}
+	if r.Char != 0 {
+		return validateTarget(strings.Repeat(string(r.Char), r.Length), opts, layout)
+	}
+	return nil
+}
+
+// runScanner finds runs of repeated characters, comparing them through fold
+type runScanner struct {
+	char   byte // canonical character, or zero for any
+	length int
+	fold   *equivalenceTable
+}
+
+// find returns the offsets of the first run in region that is at least
+// length characters long
+func (s *runScanner) find(region []byte) (int, int, bool) {
+	start := 0
+	for i := 0; i < len(region); i++ {
+		c := s.fold[region[i]]
+		switch {
+		case s.char != 0 && c != s.char:
+			start = i + 1
+			continue
+		case s.char == 0 && i > start && c != s.fold[region[i-1]]:
+			start = i
+		}
+		if i+1-start >= s.length {
+			return start, i + 1, true
+		}
+	}
+	return 0, 0, false
+}
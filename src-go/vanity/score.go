@@ -0,0 +1,95 @@
+package vanity
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// weight returns the weight of the i-th target, which is one unless
+// Options.Weights says otherwise
+func (opts Options) weight(i int) int {
+	if i < len(opts.Weights) {
+		return opts.Weights[i]
+	}
+	return 1
+}
+
+// validateScore reports why opts cannot score keys against MinScore
+func validateScore(opts Options) error {
+	if opts.MinScore == 0 {
+		if len(opts.Weights) > 0 {
+			return fmt.Errorf("target weights only apply with a minimum score")
+		}
+		return nil
+	}
+
+	switch {
+	case opts.MinScore < 0:
+		return fmt.Errorf("the minimum score cannot be negative")
+	case len(opts.Targets) == 0:
+		return fmt.Errorf("a minimum score needs weighted target sequences")
+	case opts.RequireAll:
+		return fmt.Errorf("a minimum score replaces requiring every target; give one or the other")
+	case opts.MinCount > 1:
+		return fmt.Errorf("occurrences of weighted targets cannot be counted")
+	case len(opts.Weights) > len(opts.Targets):
+		return fmt.Errorf("%d weights given for %d target sequences", len(opts.Weights), len(opts.Targets))
+	}
+
+	total := 0
+	for i, target := range opts.Targets {
+		if opts.weight(i) <= 0 {
+			return fmt.Errorf("the weight of target sequence %q must be positive", target)
+		}
+		total += opts.weight(i)
+	}
+	if total < opts.MinScore {
+		return fmt.Errorf("the weights of all targets add up to %d, short of the minimum score of %d", total, opts.MinScore)
+	}
+	return nil
+}
+
+// score sums the weights of the targets found in region, with lowered as for
+// matchTarget
+func (m *matcher) score(region, lowered []byte) int {
+	score := 0
+	for i, weight := range m.weights {
+		if m.matchTarget(region, lowered, i) {
+			score += weight
+		}
+	}
+	return score
+}
+
+// offerScore raises the shared top score to score if it is higher
+func (m *matcher) offerScore(score int) {
+	if m.topScore == nil {
+		return
+	}
+	for {
+		top := atomic.LoadInt64(m.topScore)
+		if int64(score) <= top || atomic.CompareAndSwapInt64(m.topScore, top, int64(score)) {
+			return
+		}
+	}
+}
+
+// scoreProbability returns the chance that the weights of the targets found
+// add up to at least minScore, when the i-th target is found with chance
+// probs[i] independently of the others
+func scoreProbability(probs []float64, weights func(i int) int, minScore int) float64 {
+	// reached[s] is the chance of scoring exactly s so far, with every
+	// score of minScore or more counted at minScore
+	reached := make([]float64, minScore+1)
+	reached[0] = 1
+	for i, p := range probs {
+		w := weights(i)
+		// Going down means every score moves up at most once per target
+		for s := minScore - 1; s >= 0; s-- {
+			moved := reached[s] * p
+			reached[min(s+w, minScore)] += moved
+			reached[s] -= moved
+		}
+	}
+	return reached[minScore]
+}
@@ -0,0 +1,17 @@
+package vanity
+
+import (
+	"encoding/binary"
+	"io"
+	mrand "math/rand/v2"
+)
+
+// seededReader returns the deterministic stream of the given worker for
+// Options.Seed. Every worker gets a stream of its own, so a search with a
+// single worker always finds the same key after the same number of attempts.
+func seededReader(seed uint64, worker int) io.Reader {
+	var key [32]byte
+	binary.LittleEndian.PutUint64(key[:8], seed)
+	binary.LittleEndian.PutUint64(key[8:16], uint64(worker))
+	return mrand.NewChaCha8(key)
+}
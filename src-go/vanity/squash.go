@@ -0,0 +1,109 @@
+package vanity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isSymbol reports whether c is one of the two base64 characters that are
+// neither letters nor digits
+func isSymbol(c byte) bool {
+	return c == '+' || c == '/'
+}
+
+// validateSquash reports why opts cannot look past symbols. Only plain
+// literal targets in a base64 field can be spread over them.
+func validateSquash(opts Options) error {
+	switch {
+	case opts.MaxGaps < 0:
+		return fmt.Errorf("the number of symbols to allow within a match cannot be negative")
+	case opts.Field != FieldKey && opts.Field != FieldFingerprint:
+		return fmt.Errorf("symbols can only be skipped in the key or its SHA256 fingerprint")
+	case opts.Regex:
+		return fmt.Errorf("symbols cannot be skipped in regular expressions")
+	case len(opts.Targets) == 0:
+		return fmt.Errorf("symbols can only be skipped in target sequences")
+	case opts.MaxMismatch > 0:
+		return fmt.Errorf("symbols cannot be skipped in targets with mismatched characters")
+	case opts.CaseBudget > 0:
+		return fmt.Errorf("symbols cannot be skipped in targets with a case budget")
+	case opts.MinCount > 1:
+		return fmt.Errorf("occurrences of a target with skipped symbols cannot be counted")
+	case opts.Delimited:
+		return fmt.Errorf("delimited matches cannot skip symbols")
+	case opts.Best != nil:
+		return fmt.Errorf("a best-effort search cannot score targets with skipped symbols")
+	}
+
+	for _, target := range opts.Targets {
+		if hasPatterns(target) || hasCaseEscapes(target) {
+			return fmt.Errorf("target sequence %q uses wildcards, character classes or case escapes, which cannot be combined with skipped symbols", target)
+		}
+		if strings.ContainsAny(target, "+/") {
+			return fmt.Errorf("target sequence %q contains '+' or '/', which are skipped rather than matched", target)
+		}
+	}
+	return nil
+}
+
+// squash matches a literal target in a region as if its '+' and '/' were
+// removed, as long as no more than maxGaps of them fall within the match.
+// The match itself starts and ends on characters of the target.
+type squash struct {
+	target  []byte // canonical through fold
+	maxGaps int
+	fold    *equivalenceTable
+}
+
+// at returns the end of the match starting at offset i of region, if any
+func (s *squash) at(region []byte, i int) (int, bool) {
+	gaps, k := 0, 0
+	for j := i; j < len(region); j++ {
+		switch {
+		case s.fold[region[j]] == s.target[k]:
+			k++
+			if k == len(s.target) {
+				return j + 1, true
+			}
+		case k > 0 && isSymbol(region[j]) && gaps < s.maxGaps:
+			gaps++
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// find returns the offsets of the first match in region, anchored as mode
+// requires. A suffix is the last match that ends with the region.
+func (s *squash) find(region []byte, mode Mode, at int) (int, int, bool) {
+	first, last := 0, len(region)-len(s.target)
+	switch mode {
+	case ModePrefix, ModeAt:
+		first, last = at, at
+	case ModeSuffix:
+		first = max(last-s.maxGaps, 0)
+	}
+	for i := max(first, 0); i <= last; i++ {
+		end, ok := s.at(region, i)
+		if ok && (mode != ModeSuffix || end == len(region)) {
+			return i, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// gapFactor estimates how much more likely a target of n characters becomes
+// when up to k symbols may fall between them, each character of the field
+// being a symbol with chance symbol
+func gapFactor(n, k int, symbol float64) float64 {
+	// The ways of spreading g symbols over the n-1 places between
+	// characters, starting from C(n-2, 0)
+	factor, ways, power := 1.0, 1.0, 1.0
+	for g := 1; g <= k && n > 1; g++ {
+		ways = ways * float64(n-2+g) / float64(g)
+		power *= symbol
+		factor += ways * power
+	}
+	return factor
+}
@@ -0,0 +1,97 @@
+package vanity
+
+import "fmt"
+
+// validateSubsequence reports why opts cannot match targets as subsequences.
+// Only plain literal targets can be spread over the field, and since they
+// may start anywhere they cannot be anchored.
+func validateSubsequence(opts Options) error {
+	switch {
+	case opts.Mode != ModeAnywhere:
+		return fmt.Errorf("a subsequence is spread over the whole field and cannot be anchored")
+	case opts.Regex:
+		return fmt.Errorf("regular expressions cannot be matched as subsequences")
+	case len(opts.Targets) == 0:
+		return fmt.Errorf("only target sequences can be matched as subsequences")
+	case opts.MaxMismatch > 0:
+		return fmt.Errorf("subsequences cannot allow mismatched characters")
+	case opts.CaseBudget > 0:
+		return fmt.Errorf("subsequences cannot have a case budget")
+	case opts.MaxGaps > 0:
+		return fmt.Errorf("subsequences already skip every character between their own")
+	case opts.MinCount > 1:
+		return fmt.Errorf("occurrences of a subsequence cannot be counted")
+	case opts.Delimited:
+		return fmt.Errorf("subsequences cannot be delimited")
+	case opts.Best != nil:
+		return fmt.Errorf("a best-effort search cannot score subsequences")
+	}
+
+	for _, target := range opts.Targets {
+		if hasPatterns(target) || hasCaseEscapes(target) {
+			return fmt.Errorf("target sequence %q uses wildcards, character classes or case escapes, which cannot be matched as a subsequence", target)
+		}
+	}
+	return nil
+}
+
+// subsequence matches the characters of a literal target in order anywhere
+// in a region, with anything in between
+type subsequence struct {
+	target []byte // canonical through fold
+	fold   *equivalenceTable
+}
+
+// positions returns the offset within region of each character of the
+// target, taking the earliest of each in turn, or nil if the region does not
+// hold them all in order
+func (s *subsequence) positions(region []byte) []int {
+	var found []int
+	k := 0
+	for j := 0; j < len(region) && k < len(s.target); j++ {
+		if s.fold[region[j]] == s.target[k] {
+			found = append(found, j)
+			k++
+		}
+	}
+	if k < len(s.target) {
+		return nil
+	}
+	return found
+}
+
+// find returns the offsets of the first and just past the last character of
+// the earliest match in region
+func (s *subsequence) find(region []byte) (int, int, bool) {
+	k, start := 0, 0
+	for j := 0; j < len(region); j++ {
+		if s.fold[region[j]] != s.target[k] {
+			continue
+		}
+		if k == 0 {
+			start = j
+		}
+		k++
+		if k == len(s.target) {
+			return start, j + 1, true
+		}
+	}
+	return 0, 0, false
+}
+
+// subsequenceProbability estimates the chance that the characters of a
+// target, each matching with the chance given in probs, all appear in order
+// among n independent characters. Each character read either takes the walk
+// one step along the target or leaves it where it is.
+func subsequenceProbability(probs []float64, n int) float64 {
+	reached := make([]float64, len(probs)+1)
+	reached[0] = 1
+	for range n {
+		for k := len(probs) - 1; k >= 0; k-- {
+			step := reached[k] * probs[k]
+			reached[k] -= step
+			reached[k+1] += step
+		}
+	}
+	return reached[len(probs)]
+}
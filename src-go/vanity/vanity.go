@@ -0,0 +1,753 @@
+// Package vanity searches for ed25519, RSA or ECDSA SSH keys whose public key
+// contains a chosen sequence of characters.
+package vanity
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Options describes a vanity key search
+type Options struct {
+	KeyType KeyType
+	Bits    int            // RSA modulus size; zero selects DefaultRSABits
+	Curve   elliptic.Curve // ECDSA curve; nil selects P-256
+
+	// Targets lists the sequences to look for. A key containing any one of
+	// them is accepted unless RequireAll is set.
+	Targets []string
+
+	// TargetCases overrides CaseInsensitive for the target at the same
+	// index; targets beyond its end follow SmartCase or CaseInsensitive
+	TargetCases []Case
+
+	// SmartCase, like vim's smartcase, ignores case for targets written
+	// without an uppercase letter, digits-only ones included, and compares
+	// the others exactly. It replaces CaseInsensitive, and TargetCases
+	// still override it target by target.
+	SmartCase bool
+
+	// FingerprintTargets lists sequences the SHA256 fingerprint must also
+	// contain, anywhere, on top of what the key itself must match. They are
+	// compared like Targets, following CaseInsensitive, Regex, RequireAll,
+	// Confusables, MaxMismatch and CaseBudget, and need Field to be FieldKey.
+	FingerprintTargets []string
+
+	// FingerprintRegex, when set, is a regular expression the whole SHA256
+	// fingerprint, "SHA256:" prefix included, must also match, as in
+	// ^SHA256:[A-Za-z0-9+/]*cafe. It is compiled once, compared in exact
+	// case whatever CaseInsensitive says unless it starts with (?i), and
+	// only checked once the key itself matches, since hashing a candidate
+	// and running a regular expression over it cost more than the key.
+	FingerprintRegex string
+
+	// MinScore, when positive, accepts a key once the Weights of the targets
+	// it holds add up to at least that much, instead of any one or all of
+	// them. Weights gives the weight of the target at the same index, and
+	// targets beyond its end weigh one.
+	MinScore int
+	Weights  []int
+
+	// TopScore, when non-nil, is updated atomically with the highest score
+	// any key has reached so callers can report progress
+	TopScore *int64
+
+	// Run, when set, looks for a run of repeated characters instead of
+	// Targets, which must then be empty
+	Run *Run
+
+	// Palindrome, when positive, looks for a palindrome of at least that many
+	// characters instead of Targets, which must then be empty
+	Palindrome int
+
+	// Pronounceable, when positive, requires the key body or fingerprint to
+	// end in that many characters forming syllables such as "tabeko", instead
+	// of containing Targets, which must then be empty
+	Pronounceable int
+
+	// Randomart lists cells the randomart of an accepted key must show, on
+	// top of matching Targets, Run, Palindrome or Pronounceable when given
+	Randomart []ArtCell
+
+	// Charsets lists regions whose characters must all belong to a class,
+	// also on top of any other requirement
+	Charsets []CharsetRegion
+
+	Field           Field
+	CaseInsensitive bool // fold ASCII case when comparing
+	Regex           bool // treat Targets as regular expressions
+	RequireAll      bool // require every target instead of any one
+	Confusables     bool // let look-alike characters such as 0 and O match each other
+	Mode            Mode
+	Scope           Scope
+	At              int // match position after the fixed header for ModeAt
+
+	// Delimited only accepts a literal target whose neighbours differ in
+	// class, lowercase, uppercase or neither, from the matched characters
+	// next to them, as in "9Dave7", so the target stands out. The edges of
+	// the searched region count as boundaries.
+	Delimited bool
+
+	// MaxMismatch, when positive, also accepts a window the length of a
+	// literal target where up to that many characters differ from it
+	MaxMismatch int
+
+	// MaxGaps, when positive, matches literal targets in the key or
+	// fingerprint as if its '+' and '/' were removed, accepting a match that
+	// has up to that many of them between its characters. Match offsets
+	// cover the match as it appears, symbols included.
+	MaxGaps int
+
+	// Subsequence matches the characters of each literal target in order
+	// anywhere in the searched region, with any characters between them, so
+	// "yegor" may be spread over the whole key. Match offsets run from the
+	// first character to just past the last, and Match.Positions gives each
+	// of them. It needs ModeAnywhere.
+	Subsequence bool
+
+	// CaseBudget, when positive, compares literal targets ignoring case but
+	// only accepts a window where at most that many letters differ in case
+	// from the target as typed, so a match stays readable. It implies
+	// CaseInsensitive.
+	CaseBudget int
+
+	// MinCount, when above one, only accepts ModeAnywhere matches where a
+	// target occurs at least that many times, overlaps included
+	MinCount int
+
+	// Exclude lists sequences that must not appear anywhere within the
+	// Scope of an accepted key, whatever the Mode. They are compared like
+	// literal targets, folding case and look-alikes as set.
+	Exclude []string
+
+	// Last, when positive, only accepts ModeAnywhere matches lying entirely
+	// within that many characters at the end of the key body or fingerprint,
+	// the part left visible when a key is truncated for display.
+	Last int
+
+	// Range, when set, only accepts ModeAnywhere matches of the targets that
+	// start within it, so a target can be kept clear of the fixed header and
+	// the end of the key
+	Range *Range
+
+	// Workers is the number of goroutines generating keys. Zero selects
+	// DefaultWorkers.
+	Workers int
+
+	// BatchSize is the number of keys each worker generates between updates
+	// of the shared attempt counter. Larger batches mean less contention on
+	// the counter but a laggier Attempts value. Zero selects DefaultBatchSize
+	// for ed25519 keys; RSA keys take long enough to generate that they are
+	// counted one at a time.
+	BatchSize uint64
+
+	// MaxAttempts stops the search with ErrMaxAttempts once that many keys
+	// have been generated without a match, and never more: the workers
+	// claim their batches from it and the last ones are cut short. Zero
+	// means no limit.
+	MaxAttempts uint64
+
+	// Attempts, when non-nil, is updated atomically with the running number
+	// of keys generated so callers can report progress.
+	Attempts *uint64
+
+	// OnProgress, when non-nil, is called every ProgressInterval with the
+	// keys generated so far and the time since the workers started. The
+	// calls come one at a time from a single goroutine and stop before the
+	// search returns, so the callback needs no locking of its own. Zero
+	// ProgressInterval selects DefaultProgressInterval.
+	OnProgress       func(attempts uint64, elapsed time.Duration)
+	ProgressInterval time.Duration
+
+	// WorkerAttempts, when non-nil, is updated atomically with the number of
+	// keys each worker has generated, indexed by worker, so callers can spot
+	// starved workers. It must hold at least Workers counters.
+	WorkerAttempts []uint64
+
+	// Rejected, when non-nil, is updated atomically with the number of keys
+	// that matched but were rejected for holding an excluded sequence.
+	Rejected *uint64
+
+	// Blocklist lists sequences, such as DefaultBlocklist, that must appear
+	// neither in the base64 body nor in the SHA256 fingerprint of an
+	// accepted key, whatever Field is searched. They are compared ignoring
+	// case and only checked once a key matches; any a literal target holds
+	// is skipped.
+	Blocklist []string
+
+	// Blocked, when non-nil, is updated atomically with the number of keys
+	// that matched but were rejected for holding a Blocklist sequence.
+	Blocked *uint64
+
+	// Avoid lists characters that must not appear anywhere in the variable
+	// part of the base64 key body of an accepted key, whatever Field is
+	// searched, such as "lI0O" for a key that cannot be misread. They are
+	// compared exactly and only checked once a key matches.
+	Avoid string
+
+	// Avoided, when non-nil, is updated atomically with the number of keys
+	// that matched but were rejected for holding an Avoid character.
+	Avoided *uint64
+
+	// Best, when non-nil, makes the search best-effort: it keeps the key that
+	// came closest to matching the single literal target, which Search
+	// returns as a partial Result alongside the error when it stops without
+	// a full match. Callers may also read it to report progress.
+	Best *BestEffort
+
+	// Words, when set, hunts for the longest of these words instead of
+	// matching targets. Such a search never completes on its own: it keeps
+	// the key holding the longest word in Best, which must be set, until ctx
+	// is done or MaxAttempts is reached. Words that cannot appear in Field
+	// are skipped, and CaseInsensitive applies to them as to targets.
+	Words []string
+
+	// Seed, when non-nil, draws ed25519 keys from a deterministic ChaCha8
+	// stream instead of crypto/rand, so that tests and demos can be
+	// reproduced. Each worker has a stream of its own, so only a single
+	// worker repeats the very same attempts. Anyone who knows the seed can
+	// regenerate these keys: never use them as real credentials.
+	Seed *uint64
+}
+
+// Result is a generated key pair that satisfied the search
+type Result struct {
+	PrivateKey     crypto.Signer // ed25519.PrivateKey, *rsa.PrivateKey or *ecdsa.PrivateKey
+	PublicKey      crypto.PublicKey
+	AuthorizedKey  string // authorized_keys line, including the trailing newline
+	Fingerprint    string // SHA256 fingerprint, including the "SHA256:" prefix
+	MD5Fingerprint string // legacy colon-separated MD5 fingerprint
+	BubbleBabble   string // Bubble Babble digest, as printed by ssh-keygen -B
+	PublicKeyHex   string // raw ed25519 public key as lowercase hex, empty for other key types
+	Randomart      string // framed randomart, as printed by ssh-keygen -lv
+
+	Attempts      uint64 // attempts counted when the match was found
+	TotalAttempts uint64 // attempts across all workers once they stopped
+
+	Matches []Match // every target found, in Options.Targets, Options.FingerprintTargets then Options.FingerprintRegex order
+	Score   int     // total weight of the targets found, with Options.MinScore
+
+	// Partial is set on the closest key of a best-effort search that stopped
+	// without a full match. Its single Match covers the part of the target
+	// that was found, or the longest word for Options.Words.
+	Partial bool
+
+	// Job is the index of the job the key satisfied in a SearchJobs search
+	Job int
+}
+
+// ErrMaxAttempts is returned by Search when Options.MaxAttempts keys were
+// generated without finding a match
+var ErrMaxAttempts = errors.New("maximum number of attempts reached")
+
+// DefaultBatchSize is the batch size used when Options.BatchSize is zero
+const DefaultBatchSize = 1000
+
+// DefaultProgressInterval is how often Options.OnProgress is called when
+// Options.ProgressInterval is zero
+const DefaultProgressInterval = time.Second
+
+// DefaultWorkers returns the worker count used when Options.Workers is zero
+func DefaultWorkers() int {
+	return runtime.NumCPU() * 3
+}
+
+// Validate reports whether opts describe a search that can run
+func (opts Options) Validate() error {
+	_, err := newMatcher(opts)
+	return err
+}
+
+// Search generates keys until one matches opts or ctx is cancelled, in which
+// case it returns ctx.Err(), or until Options.MaxAttempts is reached. A
+// best-effort search that stops early also returns its closest key, if any,
+// along with the error.
+func Search(ctx context.Context, opts Options) (*Result, error) {
+	results, err := search(ctx, opts, 1)
+	if len(results) == 0 {
+		return nil, err
+	}
+	return results[0], err
+}
+
+// SearchN keeps generating keys after the first match until count distinct
+// keys match opts, and returns them in the order they were found. When ctx is
+// cancelled or Options.MaxAttempts is reached first, it returns the keys found
+// so far along with the error. A best-effort search keeps a single key, so it
+// cannot look for more than one.
+func SearchN(ctx context.Context, opts Options, count int) ([]*Result, error) {
+	switch {
+	case count < 1:
+		return nil, fmt.Errorf("the number of keys to find must be positive")
+	case count > 1 && opts.Best != nil:
+		return nil, fmt.Errorf("a best-effort search keeps a single key and cannot look for %d", count)
+	}
+	return search(ctx, opts, count)
+}
+
+// search runs the workers until count keys match, as SearchN describes
+func search(ctx context.Context, opts Options, count int) ([]*Result, error) {
+	m, err := newMatcher(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Attempts == nil {
+		opts.Attempts = new(uint64)
+	}
+
+	// Collect distinct keys until there are enough or the search stops. Keys
+	// come from independent streams, but a repeat must not count twice.
+	var results []*Result
+	seen := make(map[string]bool)
+	err = runWorkers(ctx, opts, []*matcher{m}, nil, count > 1, func(r Result) bool {
+		if !seen[r.AuthorizedKey] && len(results) < count {
+			seen[r.AuthorizedKey] = true
+			results = append(results, &r)
+		}
+		return len(results) == count
+	})
+
+	// A best-effort search that stopped short still has its closest key
+	if err != nil {
+		if len(results) == 0 && opts.Best != nil {
+			if best := opts.Best.Result(); best != nil {
+				results = append(results, best)
+			}
+		}
+	}
+
+	for _, result := range results {
+		result.TotalAttempts = atomic.LoadUint64(opts.Attempts)
+	}
+	return results, err
+}
+
+// runWorkers generates keys for every matcher in ms that done does not mark
+// as finished, handing each match to take until it reports that it has all it
+// needs, when it returns nil, or the search stops, when it returns why. A nil
+// done means no matcher is ever finished, and with more unset the workers
+// stop at their first match.
+func runWorkers(ctx context.Context, opts Options, ms []*matcher, done []atomic.Bool, more bool, take func(Result) bool) error {
+	numWorkers := opts.Workers
+	if numWorkers <= 0 {
+		numWorkers = DefaultWorkers()
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+		if opts.KeyType == KeyRSA {
+			batchSize = 1
+		}
+	}
+
+	if opts.WorkerAttempts != nil && len(opts.WorkerAttempts) < numWorkers {
+		return fmt.Errorf("%d worker attempt counters given for %d workers", len(opts.WorkerAttempts), numWorkers)
+	}
+
+	generate := opts.keyGenerator(rand.Reader)
+
+	totalAttempts := opts.Attempts
+	if totalAttempts == nil {
+		totalAttempts = new(uint64)
+	}
+
+	rejected := opts.Rejected
+	if rejected == nil {
+		rejected = new(uint64)
+	}
+	blocked := opts.Blocked
+	if blocked == nil {
+		blocked = new(uint64)
+	}
+	avoided := opts.Avoided
+	if avoided == nil {
+		avoided = new(uint64)
+	}
+
+	// Workers stop as soon as the caller cancels, a match is found or they
+	// use up MaxAttempts between them
+	workerCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var budget *attemptBudget
+	if opts.MaxAttempts > 0 {
+		start := atomic.LoadUint64(totalAttempts)
+		if start >= opts.MaxAttempts {
+			return ErrMaxAttempts
+		}
+		budget = &attemptBudget{max: opts.MaxAttempts}
+		budget.reserved.Store(start)
+		budget.spent.Store(start)
+	}
+
+	resultChan := make(chan Result, 1)
+
+	var wg sync.WaitGroup
+
+	// Start workers
+	for i := 0; i < numWorkers; i++ {
+		var workerAttempts *uint64
+		if opts.WorkerAttempts != nil {
+			workerAttempts = &opts.WorkerAttempts[i]
+		}
+		workerGenerate := generate
+		if opts.Seed != nil {
+			workerGenerate = opts.keyGenerator(seededReader(*opts.Seed, i))
+		}
+		wg.Add(1)
+		go worker(workerCtx, cancel, i, ms, done, workerGenerate, batchSize, budget, totalAttempts, workerAttempts, rejected, blocked, avoided, opts.Best, more, resultChan, &wg)
+	}
+
+	// Progress is reported until the workers stop, and waited for with them
+	if opts.OnProgress != nil {
+		interval := opts.ProgressInterval
+		if interval <= 0 {
+			interval = DefaultProgressInterval
+		}
+		wg.Add(1)
+		go reportProgress(workerCtx, opts.OnProgress, interval, totalAttempts, &wg)
+	}
+
+	finished := false
+collect:
+	for !finished {
+		select {
+		case r := <-resultChan:
+			finished = take(r)
+		case <-workerCtx.Done():
+			break collect
+		}
+	}
+	// Read the cause before cancelling would turn it into context.Canceled
+	cause := context.Cause(workerCtx)
+	cancel(nil)
+	wg.Wait()
+
+	// A match may have raced with the cancellation; it is still valid
+	select {
+	case r := <-resultChan:
+		if !finished {
+			finished = take(r)
+		}
+	default:
+	}
+	if finished {
+		return nil
+	}
+	return cause
+}
+
+// reportProgress calls onProgress every interval until ctx is done
+func reportProgress(ctx context.Context, onProgress func(uint64, time.Duration), interval time.Duration, totalAttempts *uint64, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			onProgress(atomic.LoadUint64(totalAttempts), time.Since(start))
+		}
+	}
+}
+
+func worker(ctx context.Context, stop context.CancelCauseFunc, id int, ms []*matcher, done []atomic.Bool, generate func() (crypto.Signer, error), batchSize uint64, budget *attemptBudget, totalAttempts, workerAttempts, rejected, blocked, avoided *uint64, best *BestEffort, more bool, resultChan chan Result, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Every job searches the same field of the same key type, so the first
+	// says how to build the subject
+	m := ms[0]
+
+	attempts := uint64(0)
+
+	// Count the partial batch too, whichever way the worker stops, so the
+	// final total covers every key generated
+	defer func() {
+		atomic.AddUint64(totalAttempts, attempts)
+		if workerAttempts != nil {
+			atomic.AddUint64(workerAttempts, attempts)
+		}
+	}()
+
+	// Scratch space for the subjects of each field
+	var line, fingerprint []byte
+	var md5Hex [md5HexLen]byte
+	var babble [bubbleBabbleLen]byte
+	var rawHex [publicKeyHexLen]byte
+
+	// The wire blob of an ed25519 key is a fixed header and the public key,
+	// which is far cheaper to splice in than going through ssh.NewPublicKey
+	ed25519Blob := append([]byte(nil), ed25519BlobHeader...)
+	ed25519Blob = append(ed25519Blob, make([]byte, ed25519.PublicKeySize)...)
+
+	// Scratch space for lowercasing the region of case-insensitive searches
+	var lowered []byte
+
+	for {
+		// Check for cancellation less frequently
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Claim the batch from what is left of MaxAttempts; the last one
+		// may come up short
+		batch := batchSize
+		if budget != nil {
+			if batch = budget.reserve(batchSize); batch == 0 {
+				return
+			}
+		}
+
+		// Process a batch without checking the context for maximum performance
+		for i := uint64(0); i < batch; i++ {
+			privKey, err := generate()
+			if err != nil {
+				continue
+			}
+
+			attempts++
+
+			// Every subject derives from the wire blob. The ssh package
+			// is only asked for it when there is no shortcut, and for the
+			// key itself once a result needs building.
+			var blob []byte
+			var sshPubKey ssh.PublicKey
+			if priv, ok := privKey.(ed25519.PrivateKey); ok {
+				copy(ed25519Blob[len(ed25519BlobHeader):], priv[ed25519.SeedSize:])
+				blob = ed25519Blob
+			} else {
+				sshPubKey, err = ssh.NewPublicKey(privKey.Public())
+				if err != nil {
+					continue
+				}
+				blob = sshPubKey.Marshal()
+			}
+
+			var subject []byte
+			switch m.field {
+			case FieldFingerprint:
+				fingerprint = appendFingerprint(fingerprint[:0], blob)
+				subject = fingerprint
+			case FieldMD5Fingerprint:
+				sum := md5.Sum(blob)
+				subject = md5Hex[:]
+				hex.Encode(subject, sum[:])
+			case FieldBubbleBabble:
+				sum := sha1.Sum(blob)
+				subject = appendBubbleBabble(babble[:0], sum[:])
+			case FieldHex:
+				subject = rawHex[:]
+				hex.Encode(subject, blob[len(ed25519BlobHeader):])
+			default:
+				line = appendAuthorizedKey(line[:0], m.layout.typePrefix, blob)
+				subject = line
+			}
+
+			for j, m := range ms {
+				if done != nil && done[j].Load() {
+					continue
+				}
+				index, ok := m.match(subject, &lowered)
+				if ok && m.excludes != nil && m.excluded(subject) {
+					atomic.AddUint64(rejected, 1)
+					continue
+				}
+				var fingerprintIndex int
+				if ok && (m.fingerprint != nil || m.fingerprintRegex != nil) {
+					// Hashing is only worth it for keys that already match
+					fingerprint = appendFingerprint(fingerprint[:0], blob)
+					if m.fingerprint != nil {
+						fingerprintIndex, ok = m.fingerprint.match(fingerprint, &lowered)
+					}
+					if ok && m.fingerprintRegex != nil {
+						ok = m.fingerprintRegex.Match(fingerprint)
+					}
+				}
+				if ok && m.art != nil {
+					// Only drawn once everything else matches
+					sum := sha256.Sum256(blob)
+					ok = drawArt(sum[:]).matches(m.art)
+				}
+				if ok && m.avoid != nil && m.hasAvoided(blob, &line) {
+					atomic.AddUint64(avoided, 1)
+					continue
+				}
+				if ok && m.blocklist != nil && m.isBlocked(blob, &line, &fingerprint) {
+					atomic.AddUint64(blocked, 1)
+					continue
+				}
+				if ok && sshPubKey == nil {
+					if sshPubKey, err = ssh.NewPublicKey(privKey.Public()); err != nil {
+						continue
+					}
+				}
+				if ok {
+					// Only build the strings when we have a match
+					result := m.newResult(privKey, sshPubKey, atomic.LoadUint64(totalAttempts)+attempts)
+					result.Job = j
+					result.Matches = m.matches(subject, index)
+					if m.weights != nil {
+						region, _ := m.region(subject)
+						result.Score = m.score(region, m.lower(region, new([]byte)))
+					}
+					if m.fingerprint != nil {
+						result.Matches = append(result.Matches, m.fingerprint.matches(fingerprint, fingerprintIndex)...)
+					}
+					if m.fingerprintRegex != nil {
+						loc := m.fingerprintRegex.FindIndex(fingerprint)
+						result.Matches = append(result.Matches, Match{Target: m.fingerprintRegex.String(), Field: FieldFingerprint, Start: loc[0], End: loc[1], Spans: []Span{{loc[0], loc[1]}}})
+					}
+					// The search may want more than one key
+					select {
+					case resultChan <- result:
+						if !more {
+							return
+						}
+					case <-ctx.Done():
+						return
+					}
+					// One key never serves two jobs
+					break
+				}
+			}
+
+			if best != nil {
+				// Most keys do no better than the current best, so the
+				// lock is only taken for an improvement
+				region, shift := m.region(subject)
+				if score, start, end, target := m.nearMiss(region); score > best.score.Load() && !(m.excludes != nil && m.excluded(subject)) && !(m.avoid != nil && m.hasAvoided(blob, &line)) && !(m.blocklist != nil && m.isBlocked(blob, &line, &fingerprint)) {
+					if sshPubKey == nil {
+						if sshPubKey, err = ssh.NewPublicKey(privKey.Public()); err != nil {
+							continue
+						}
+					}
+					result := m.newResult(privKey, sshPubKey, atomic.LoadUint64(totalAttempts)+attempts)
+					result.Matches = []Match{m.newMatch(target, shift+start, shift+end)}
+					result.Partial = true
+					best.offer(score, result)
+				}
+			}
+		}
+
+		// Update global counter after processing the batch
+		atomic.AddUint64(totalAttempts, attempts)
+		if workerAttempts != nil {
+			atomic.AddUint64(workerAttempts, attempts)
+		}
+		attempts = 0
+
+		// Whoever finishes the last batch stops the search, once every
+		// key allowed has been checked
+		if budget != nil && budget.spend(batch) {
+			stop(ErrMaxAttempts)
+			return
+		}
+	}
+}
+
+// attemptBudget hands out Options.MaxAttempts to the workers a batch at a
+// time, so that no more keys than that are ever generated. Reserved counts
+// the keys claimed and spent those whose batch is done.
+type attemptBudget struct {
+	max             uint64
+	reserved, spent atomic.Uint64
+}
+
+// reserve claims up to n of the attempts left and returns how many it got,
+// which is zero once they are all claimed
+func (b *attemptBudget) reserve(n uint64) uint64 {
+	for {
+		used := b.reserved.Load()
+		if used >= b.max {
+			return 0
+		}
+		n = min(n, b.max-used)
+		if b.reserved.CompareAndSwap(used, used+n) {
+			return n
+		}
+	}
+}
+
+// spend records n claimed attempts as done and reports whether that was the
+// last of them
+func (b *attemptBudget) spend(n uint64) bool {
+	return b.spent.Add(n) == b.max
+}
+
+// newResult describes a generated key pair found after the given number of
+// attempts, leaving the matches to the caller
+func (m *matcher) newResult(privKey crypto.Signer, sshPubKey ssh.PublicKey, attempts uint64) Result {
+	return Result{
+		PrivateKey:     privKey,
+		PublicKey:      privKey.Public(),
+		AuthorizedKey:  string(ssh.MarshalAuthorizedKey(sshPubKey)),
+		Fingerprint:    ssh.FingerprintSHA256(sshPubKey),
+		MD5Fingerprint: ssh.FingerprintLegacyMD5(sshPubKey),
+		BubbleBabble:   bubbleBabble(sshPubKey),
+		PublicKeyHex:   publicKeyHex(privKey.Public()),
+		Randomart:      randomart(sshPubKey.Marshal(), m.artTitle),
+		Attempts:       attempts,
+	}
+}
+
+// isBlocked reports whether the key with the given wire blob shows a word of
+// the blocklist. The worker's line and fingerprint scratch space is reused;
+// whatever subject it held is rebuilt the same.
+func (m *matcher) isBlocked(blob []byte, line, fingerprint *[]byte) bool {
+	*line = appendAuthorizedKey((*line)[:0], m.layout.typePrefix, blob)
+	*fingerprint = appendFingerprint((*fingerprint)[:0], blob)
+	body := (*line)[len(m.layout.typePrefix) : len(*line)-1]
+	return m.blocklist.blocked(body, (*fingerprint)[len(fingerprintPrefix):])
+}
+
+// appendAuthorizedKey appends the authorized_keys line for a key of type
+// prefix, such as "ssh-ed25519 ", with the given wire blob, exactly as
+// ssh.MarshalAuthorizedKey would produce it
+func appendAuthorizedKey(dst []byte, typePrefix string, blob []byte) []byte {
+	dst = append(dst, typePrefix...)
+	dst = base64.StdEncoding.AppendEncode(dst, blob)
+	return append(dst, '\n')
+}
+
+// appendFingerprint appends the SHA256 fingerprint of a wire blob, exactly as
+// ssh.FingerprintSHA256 would produce it
+func appendFingerprint(dst, blob []byte) []byte {
+	sum := sha256.Sum256(blob)
+	dst = append(dst, fingerprintPrefix...)
+	return base64.RawStdEncoding.AppendEncode(dst, sum[:])
+}
+
+// publicKeyHex returns the raw bytes of an ed25519 public key as hex, or ""
+// for other keys, which have no such plain form
+func publicKeyHex(key crypto.PublicKey) string {
+	if pub, ok := key.(ed25519.PublicKey); ok {
+		return hex.EncodeToString(pub)
+	}
+	return ""
+}
+
+// bubbleBabble returns the Bubble Babble digest ssh-keygen -B prints for key
+func bubbleBabble(key ssh.PublicKey) string {
+	sum := sha1.Sum(key.Marshal())
+	return string(appendBubbleBabble(nil, sum[:]))
+}
@@ -0,0 +1,81 @@
+package vanity
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSplicedEd25519Blob(t *testing.T) {
+	opts := Options{}
+	typePrefix := opts.layout().typePrefix
+	for seed := uint64(0); seed < 4; seed++ {
+		generate := opts.keyGenerator(seededReader(seed, 0))
+		for i := 0; i < 8; i++ {
+			key, err := generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			priv, ok := key.(ed25519.PrivateKey)
+			if !ok {
+				t.Fatalf("generated a %T, want an ed25519 key", key)
+			}
+
+			// Splice the public key in the way the worker does
+			blob := append([]byte(nil), ed25519BlobHeader...)
+			blob = append(blob, make([]byte, ed25519.PublicKeySize)...)
+			copy(blob[len(ed25519BlobHeader):], priv[ed25519.SeedSize:])
+
+			sshPub, err := ssh.NewPublicKey(priv.Public())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(appendAuthorizedKey(nil, typePrefix, blob))
+			if want := string(ssh.MarshalAuthorizedKey(sshPub)); got != want {
+				t.Errorf("seed %d key %d: spliced line %q, want %q", seed, i, got, want)
+			}
+			if got, want := string(appendFingerprint(nil, blob)), ssh.FingerprintSHA256(sshPub); got != want {
+				t.Errorf("seed %d key %d: fingerprint %q, want %q", seed, i, got, want)
+			}
+		}
+	}
+}
+
+func TestMaxAttemptsIsExact(t *testing.T) {
+	// Batches that do not divide the limit, split across several workers
+	for _, limit := range []uint64{1, 999, 2500} {
+		var attempts uint64
+		opts := Options{
+			Targets:     []string{"yegorsyegors"},
+			Workers:     3,
+			BatchSize:   1000,
+			MaxAttempts: limit,
+			Attempts:    &attempts,
+		}
+		if _, err := Search(context.Background(), opts); !errors.Is(err, ErrMaxAttempts) {
+			t.Fatalf("Search = %v, want %v", err, ErrMaxAttempts)
+		}
+		if attempts != limit {
+			t.Errorf("MaxAttempts %d: generated %d keys", limit, attempts)
+		}
+	}
+}
+
+func BenchmarkWorker(b *testing.B) {
+	// A single seeded worker looking for a target it will not find runs
+	// exactly b.N keys through the generate, splice and match loop
+	seed := uint64(1)
+	opts := Options{
+		Targets:     []string{"yegorsyegors"},
+		Workers:     1,
+		MaxAttempts: uint64(b.N),
+		Seed:        &seed,
+	}
+	b.ResetTimer()
+	if _, err := Search(context.Background(), opts); !errors.Is(err, ErrMaxAttempts) {
+		b.Fatalf("Search = %v, want %v", err, ErrMaxAttempts)
+	}
+}
@@ -0,0 +1,100 @@
+package vanity
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+//go:embed words.txt
+var englishWords string
+
+// EnglishWords returns the built-in dictionary of lowercase English words of
+// 4 to 9 letters from the EFF large wordlist, for use as Options.Words
+func EnglishWords() []string {
+	var words []string
+	for _, line := range strings.Split(englishWords, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words
+}
+
+// wordHunt finds the longest dictionary word in a region. Every word is fed
+// into a single automaton, whose output for a state is always the longest
+// word ending there, so one pass over the region finds the longest overall.
+type wordHunt struct {
+	automaton *automaton
+	words     []string
+}
+
+// newWordHunt compiles the words of opts that can appear in the searched
+// field, skipping the rest, so a general dictionary works for any field
+func newWordHunt(opts Options, layout *keyLayout) (*wordHunt, error) {
+	h := &wordHunt{}
+	var canonical [][]byte
+	for _, word := range opts.Words {
+		if hasPatterns(word) || validateTarget(word, opts, layout) != nil {
+			continue
+		}
+		if opts.CaseInsensitive {
+			word = string(lowerASCII(word))
+		}
+		h.words = append(h.words, word)
+		canonical = append(canonical, []byte(word))
+	}
+	if len(h.words) == 0 {
+		return nil, fmt.Errorf("none of the %d words can appear in the searched field", len(opts.Words))
+	}
+	h.automaton = newAutomaton(canonical, opts.CaseInsensitive)
+	return h, nil
+}
+
+// longest returns the longest word in region and its offsets, preferring the
+// first of equally long words, or an empty word if none occurs
+func (h *wordHunt) longest(region []byte) (string, int, int) {
+	a := h.automaton
+	best, bestEnd := int32(-1), 0
+	state := int32(0)
+	for i, b := range region {
+		if a.foldCase {
+			b = toLowerCase(b)
+		}
+		state = a.next[int(state)*a.width+int(a.classes[b])]
+		if word := a.out[state]; word >= 0 && (best < 0 || a.lengths[word] > a.lengths[best]) {
+			best, bestEnd = word, i+1
+		}
+	}
+	if best < 0 {
+		return "", 0, 0
+	}
+	return h.words[best], bestEnd - a.lengths[best], bestEnd
+}
+
+// validateWords reports why opts cannot hunt for words
+func validateWords(opts Options) error {
+	switch {
+	case opts.Best == nil:
+		return fmt.Errorf("a word hunt keeps its longest word in Options.Best, which must be set")
+	case opts.searchesKey() || len(opts.FingerprintTargets) > 0 || opts.FingerprintRegex != "" || len(opts.Randomart) > 0:
+		return fmt.Errorf("a word hunt cannot be combined with other targets")
+	case opts.Mode != ModeAnywhere:
+		return fmt.Errorf("a word hunt looks anywhere in the field and cannot be anchored")
+	case opts.Regex:
+		return fmt.Errorf("a word hunt cannot use regular expressions")
+	case opts.MinCount > 1:
+		return fmt.Errorf("a word hunt cannot count repeated occurrences")
+	case opts.MaxMismatch != 0:
+		return fmt.Errorf("a word hunt cannot allow mismatches")
+	case opts.MaxGaps != 0:
+		return fmt.Errorf("a word hunt cannot skip symbols")
+	case opts.MinScore > 0:
+		return fmt.Errorf("a word hunt cannot be combined with a minimum score")
+	case opts.Delimited:
+		return fmt.Errorf("a word hunt cannot require delimited matches")
+	case opts.Confusables:
+		return fmt.Errorf("a word hunt cannot match confusable characters")
+	}
+	return nil
+}